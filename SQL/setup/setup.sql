@@ -23,22 +23,147 @@ CREATE TABLE public."Universities" (
     name varchar(255) NOT NULL,
     description text,
     student_no integer DEFAULT 0,
-    picture bytea,
+    picture_id integer,
+    time_zone varchar(64) NOT NULL DEFAULT 'UTC',
+    min_rso_members integer NOT NULL DEFAULT 5,
+    email_domains varchar(255) [] NOT NULL DEFAULT '{}',
+    latitude double precision,
+    longitude double precision,
+    archived_at timestamp with time zone,
     CONSTRAINT "Universities_pk" PRIMARY KEY (uni_id),
+    CONSTRAINT min_rso_members CHECK (min_rso_members >= 1),
+    CONSTRAINT campus_centre CHECK (
+        (latitude IS NULL AND longitude IS NULL)
+        OR (latitude BETWEEN -90 AND 90 AND longitude BETWEEN -180 AND 180)
+    ),
     CONSTRAINT uni_ques UNIQUE (name)
 );
 -- ddl-end --
 COMMENT ON COLUMN public."Universities".student_no IS E'Number of students in the university currently';
+COMMENT ON COLUMN public."Universities".min_rso_members IS E'Members an RSO needs to be active and host RSO events';
+COMMENT ON COLUMN public."Universities".time_zone IS E'IANA time zone name, used for events that do not set their own';
+COMMENT ON COLUMN public."Universities".email_domains IS E'Domains student emails must use to sign up, any when empty';
+COMMENT ON COLUMN public."Universities".latitude IS E'Campus centre, with longitude';
+COMMENT ON COLUMN public."Universities".archived_at IS E'Set when the university was archived, it then takes no new users';
+-- object: public.accessibility_feature | type: TYPE --
+-- DROP TYPE IF EXISTS public.accessibility_feature CASCADE;
+CREATE TYPE public.accessibility_feature AS ENUM (
+    'wheelchair',
+    'step_free',
+    'elevator',
+    'accessible_restroom',
+    'gender_neutral_restroom',
+    'hearing_loop'
+);
+-- ddl-end --
+-- object: public.normalize_address | type: FUNCTION --
+-- DROP FUNCTION IF EXISTS public.normalize_address(text) CASCADE;
+-- Lower case, punctuation as spaces and the usual abbreviations spelled out,
+-- so "Bldg. 1, N. Orange Ave" and "building 1 n orange avenue" compare equal
+CREATE FUNCTION public.normalize_address(address text) RETURNS text LANGUAGE plpgsql IMMUTABLE AS $$
+DECLARE result text := ' ' || regexp_replace(lower(address), '[^a-z0-9]+', ' ', 'g') || ' ';
+abbreviation text [];
+BEGIN FOREACH abbreviation SLICE 1 IN ARRAY ARRAY [
+    ['st', 'street'],
+    ['ave', 'avenue'],
+    ['rd', 'road'],
+    ['dr', 'drive'],
+    ['blvd', 'boulevard'],
+    ['ln', 'lane'],
+    ['bldg', 'building'],
+    ['rm', 'room'],
+    ['fl', 'floor'],
+    ['ctr', 'center'],
+    ['centre', 'center'],
+    ['univ', 'university']
+] LOOP result := replace(result, ' ' || abbreviation [1] || ' ', ' ' || abbreviation [2] || ' ');
+END LOOP;
+RETURN btrim(regexp_replace(result, ' +', ' ', 'g'));
+END;
+$$;
+-- ddl-end --
 -- object: public."Locations" | type: TABLE --
 -- DROP TABLE IF EXISTS public."Locations" CASCADE;
 CREATE TABLE public."Locations" (
     loc_id serial NOT NULL,
     address text,
-    latitude varchar(15) NOT NULL,
-    longitude varchar(15) NOT NULL,
-    CONSTRAINT "Locations_pk" PRIMARY KEY (loc_id)
+    latitude double precision,
+    longitude double precision,
+    parent_id integer,
+    capacity integer,
+    accessibility public.accessibility_feature [] NOT NULL DEFAULT '{}',
+    directions text,
+    normalized_address text GENERATED ALWAYS AS (public.normalize_address(address)) STORED,
+    CONSTRAINT "Locations_pk" PRIMARY KEY (loc_id),
+    CONSTRAINT capacity CHECK (capacity > 0),
+    CONSTRAINT not_own_parent CHECK (parent_id <> loc_id),
+    CONSTRAINT coordinates CHECK (
+        (latitude IS NULL AND longitude IS NULL)
+        OR (latitude BETWEEN -90 AND 90 AND longitude BETWEEN -180 AND 180)
+    )
+);
+-- ddl-end --
+COMMENT ON COLUMN public."Locations".latitude IS E'NULL together with longitude for places whose position is unknown';
+-- ddl-end --
+COMMENT ON COLUMN public."Locations".parent_id IS E'The building of a room. Buildings have none, rooms have no rooms';
+-- ddl-end --
+COMMENT ON COLUMN public."Locations".directions IS E'How to find the place, e.g. the entrance to use. Rooms without any use their building''s';
+-- ddl-end --
+-- object: locations_by_accessibility | type: INDEX --
+-- DROP INDEX IF EXISTS public.locations_by_accessibility CASCADE;
+CREATE INDEX locations_by_accessibility ON public."Locations" USING gin (accessibility);
+-- ddl-end --
+-- object: locations_by_parent | type: INDEX --
+-- DROP INDEX IF EXISTS public.locations_by_parent CASCADE;
+CREATE INDEX locations_by_parent ON public."Locations" (parent_id);
+-- ddl-end --
+-- Great-circle distances for the radius searches, both ship with Postgres
+CREATE EXTENSION IF NOT EXISTS cube;
+CREATE EXTENSION IF NOT EXISTS earthdistance;
+-- Trigram similarity for addresses spelled differently, also shipped
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+-- ddl-end --
+-- object: locations_by_position | type: INDEX --
+-- DROP INDEX IF EXISTS public.locations_by_position CASCADE;
+CREATE INDEX locations_by_position ON public."Locations" USING gist (ll_to_earth(latitude, longitude))
+WHERE latitude IS NOT NULL;
+-- ddl-end --
+-- object: locations_by_trigram | type: INDEX --
+-- DROP INDEX IF EXISTS public.locations_by_trigram CASCADE;
+CREATE INDEX locations_by_trigram ON public."Locations" USING gin (normalized_address gin_trgm_ops);
+-- ddl-end --
+-- object: public."Gazetteer" | type: TABLE --
+-- DROP TABLE IF EXISTS public."Gazetteer" CASCADE;
+CREATE TABLE public."Gazetteer" (
+    entry_id serial NOT NULL,
+    uni_id integer NOT NULL,
+    name text NOT NULL,
+    address text,
+    latitude double precision NOT NULL,
+    longitude double precision NOT NULL,
+    normalized_name text GENERATED ALWAYS AS (public.normalize_address(name)) STORED,
+    normalized_address text GENERATED ALWAYS AS (public.normalize_address(address)) STORED,
+    CONSTRAINT "Gazetteer_pk" PRIMARY KEY (entry_id),
+    CONSTRAINT gazetteer_coordinates CHECK (
+        latitude BETWEEN -90 AND 90
+        AND longitude BETWEEN -180 AND 180
+    ),
+    CONSTRAINT one_gazetteer_name UNIQUE (uni_id, normalized_name)
 );
 -- ddl-end --
+COMMENT ON TABLE public."Gazetteer" IS E'Buildings and addresses of each campus, imported by its superadmins, that addresses are geocoded against';
+-- ddl-end --
+-- object: gazetteer_by_name | type: INDEX --
+-- DROP INDEX IF EXISTS public.gazetteer_by_name CASCADE;
+CREATE INDEX gazetteer_by_name ON public."Gazetteer" USING gin (normalized_name gin_trgm_ops);
+-- ddl-end --
+-- object: gazetteer_by_address | type: INDEX --
+-- DROP INDEX IF EXISTS public.gazetteer_by_address CASCADE;
+CREATE INDEX gazetteer_by_address ON public."Gazetteer" USING gin (normalized_address gin_trgm_ops);
+-- ddl-end --
+-- object: gazetteer_by_position | type: INDEX --
+-- DROP INDEX IF EXISTS public.gazetteer_by_position CASCADE;
+CREATE INDEX gazetteer_by_position ON public."Gazetteer" USING gist (ll_to_earth(latitude, longitude));
 -- ddl-end --
 -- object: public."Users" | type: TABLE --
 -- DROP TABLE IF EXISTS public."Users" CASCADE;
@@ -50,17 +175,35 @@ CREATE TABLE public."Users" (
     username varchar(255) NOT NULL,
     password varchar(255) NOT NULL,
     user_type public.auth NOT NULL,
+    phone varchar(16),
     profile_picture bytea,
     uni_id serial,
+    platform_admin boolean NOT NULL DEFAULT false,
     CONSTRAINT "Users_pk" PRIMARY KEY (user_id),
     CONSTRAINT unique_username UNIQUE (username)
 );
 -- ddl-end --
+COMMENT ON COLUMN public."Users".phone IS E'E.164 phone number, used as the default contact for events the user creates';
+-- ddl-end --
+COMMENT ON COLUMN public."Users".platform_admin IS E'Superadmin of every university, who also assigns the others';
+-- ddl-end --
 ALTER TABLE public."Users" ENABLE ROW LEVEL SECURITY;
 -- ddl-end --
 -- object: public.event | type: TYPE --
 -- DROP TYPE IF EXISTS public.event CASCADE;
-CREATE TYPE public.event AS ENUM ('public', 'private', 'rso_event');
+CREATE TYPE public.event AS ENUM ('public', 'private', 'rso_event', 'invite_only');
+-- ddl-end --
+-- object: public.event_status | type: TYPE --
+-- DROP TYPE IF EXISTS public.event_status CASCADE;
+CREATE TYPE public.event_status AS ENUM ('scheduled', 'postponed', 'cancelled', 'completed');
+-- ddl-end --
+-- object: public.categories | type: TYPE --
+-- DROP TYPE IF EXISTS public.categories CASCADE;
+CREATE TYPE public.categories AS ENUM ('social', 'fundraising', 'tech talk', 'academic');
+-- ddl-end --
+-- object: public.rso_join_policy | type: TYPE --
+-- DROP TYPE IF EXISTS public.rso_join_policy CASCADE;
+CREATE TYPE public.rso_join_policy AS ENUM ('open', 'approval', 'invite_only');
 -- ddl-end --
 -- object: public."RSOs" | type: TABLE --
 -- DROP TABLE IF EXISTS public."RSOs" CASCADE;
@@ -71,15 +214,30 @@ CREATE TABLE public."RSOs" (
     uni_id serial NOT NULL,
     admin_id serial NOT NULL,
     date_created timestamp with time zone NOT NULL,
+    archived_at timestamp with time zone,
+    active boolean NOT NULL DEFAULT FALSE,
+    join_policy public.rso_join_policy NOT NULL DEFAULT 'open',
+    categories public."_categories" NOT NULL DEFAULT '{}',
+    logo_id integer,
     CONSTRAINT "RSOs_pk" PRIMARY KEY (rso_id),
     CONSTRAINT rso_uniques UNIQUE (name)
 );
 -- ddl-end --
+-- object: rsos_by_category | type: INDEX --
+-- DROP INDEX IF EXISTS public.rsos_by_category CASCADE;
+CREATE INDEX rsos_by_category ON public."RSOs" USING gin (categories);
+-- ddl-end --
+COMMENT ON COLUMN public."RSOs".archived_at IS E'Set when the RSO was deleted but kept so its past events still point at it';
+-- ddl-end --
 ALTER TABLE public."RSOs" ENABLE ROW LEVEL SECURITY;
 -- ddl-end --
--- object: public.categories | type: TYPE --
--- DROP TYPE IF EXISTS public.categories CASCADE;
-CREATE TYPE public.categories AS ENUM ('social', 'fundraising', 'tech talk', 'academic');
+-- object: public.attendance_mode | type: TYPE --
+-- DROP TYPE IF EXISTS public.attendance_mode CASCADE;
+CREATE TYPE public.attendance_mode AS ENUM ('in_person', 'online', 'hybrid');
+-- ddl-end --
+-- object: public.meeting_platform | type: TYPE --
+-- DROP TYPE IF EXISTS public.meeting_platform CASCADE;
+CREATE TYPE public.meeting_platform AS ENUM ('zoom', 'teams', 'meet', 'webex', 'discord', 'other');
 -- ddl-end --
 -- object: public."Events" | type: TABLE --
 -- DROP TABLE IF EXISTS public."Events" CASCADE;
@@ -90,24 +248,177 @@ CREATE TABLE public."Events" (
     description text NULL,
     start_time timestamptz NOT NULL,
     end_time timestamptz NOT NULL,
+    time_zone varchar(64) NOT NULL DEFAULT 'UTC',
     loc_id int4 NULL,
-    contact_phone varchar(15) NULL,
+    contact_phone varchar(16) NULL,
     contact_email varchar(255) NULL,
     visibility public."event" NOT NULL,
     uni_id int4 NULL,
     rso_id int4 NULL,
     superadmin_approval bool DEFAULT false NULL,
-    CONSTRAINT "Events_pk" PRIMARY KEY (event_id)
+    created_by int4 NULL,
+    status public.event_status NOT NULL DEFAULT 'scheduled',
+    status_reason text NULL,
+    attendance_mode public.attendance_mode NOT NULL DEFAULT 'in_person',
+    meeting_platform public.meeting_platform NULL,
+    meeting_url text NULL,
+    capacity integer NULL,
+    CONSTRAINT "Events_pk" PRIMARY KEY (event_id),
+    CONSTRAINT event_times CHECK (end_time > start_time),
+    CONSTRAINT event_capacity CHECK (capacity > 0),
+    CONSTRAINT event_place CHECK (
+        (attendance_mode = 'in_person' AND loc_id IS NOT NULL AND meeting_url IS NULL)
+        OR (attendance_mode = 'online' AND loc_id IS NULL AND meeting_url IS NOT NULL)
+        OR (attendance_mode = 'hybrid' AND loc_id IS NOT NULL AND meeting_url IS NOT NULL)
+    ),
+    CONSTRAINT meeting CHECK ((meeting_url IS NULL) = (meeting_platform IS NULL))
 );
 -- ddl-end --
+COMMENT ON COLUMN public."Events".meeting_url IS E'Only shown to organisers and attendees';
+-- ddl-end --
+COMMENT ON COLUMN public."Events".capacity IS E'At most the capacity of the room, which applies when this is NULL';
+-- ddl-end --
+-- object: events_by_place | type: INDEX --
+-- DROP INDEX IF EXISTS public.events_by_place CASCADE;
+CREATE INDEX events_by_place ON public."Events" (loc_id, start_time);
+-- ddl-end --
+-- object: public.rso_role | type: TYPE --
+-- DROP TYPE IF EXISTS public.rso_role CASCADE;
+CREATE TYPE public.rso_role AS ENUM ('member', 'officer', 'admin');
+-- ddl-end --
 -- object: public."User_RSO_Membership" | type: TABLE --
 -- DROP TABLE IF EXISTS public."User_RSO_Membership" CASCADE;
 CREATE TABLE public."User_RSO_Membership" (
     user_id serial NOT NULL,
     rso_id serial NOT NULL,
+    role public.rso_role NOT NULL DEFAULT 'member',
+    date_joined timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
     CONSTRAINT "User_RSO_Membership_pk" PRIMARY KEY (user_id, rso_id)
 );
 -- ddl-end --
+-- object: one_rso_admin | type: INDEX --
+-- DROP INDEX IF EXISTS public.one_rso_admin CASCADE;
+CREATE UNIQUE INDEX one_rso_admin ON public."User_RSO_Membership" (rso_id)
+WHERE role = 'admin';
+-- ddl-end --
+-- object: public.join_request_kind | type: TYPE --
+-- DROP TYPE IF EXISTS public.join_request_kind CASCADE;
+CREATE TYPE public.join_request_kind AS ENUM ('request', 'invite');
+-- ddl-end --
+-- object: public.join_request_status | type: TYPE --
+-- DROP TYPE IF EXISTS public.join_request_status CASCADE;
+CREATE TYPE public.join_request_status AS ENUM ('pending', 'approved', 'denied');
+-- ddl-end --
+-- object: public."RSO_Join_Requests" | type: TABLE --
+-- DROP TABLE IF EXISTS public."RSO_Join_Requests" CASCADE;
+CREATE TABLE public."RSO_Join_Requests" (
+    request_id serial NOT NULL,
+    rso_id integer NOT NULL,
+    user_id integer NOT NULL,
+    kind public.join_request_kind NOT NULL DEFAULT 'request',
+    message text,
+    status public.join_request_status NOT NULL DEFAULT 'pending',
+    date_requested timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    reviewed_by integer,
+    date_reviewed timestamptz,
+    CONSTRAINT "RSO_Join_Requests_pk" PRIMARY KEY (request_id)
+);
+-- ddl-end --
+COMMENT ON COLUMN public."RSO_Join_Requests".kind IS E'request: the user asked to join, invite: the officer in reviewed_by invited the user';
+-- ddl-end --
+-- object: one_pending_join | type: INDEX --
+-- DROP INDEX IF EXISTS public.one_pending_join CASCADE;
+CREATE UNIQUE INDEX one_pending_join ON public."RSO_Join_Requests" (rso_id, user_id)
+WHERE status = 'pending';
+-- ddl-end --
+-- object: public."RSO_Announcements" | type: TABLE --
+-- DROP TABLE IF EXISTS public."RSO_Announcements" CASCADE;
+CREATE TABLE public."RSO_Announcements" (
+    announcement_id serial NOT NULL,
+    rso_id integer NOT NULL,
+    author_id integer,
+    title varchar(255) NOT NULL,
+    body text NOT NULL,
+    pinned boolean NOT NULL DEFAULT FALSE,
+    expires_at timestamptz,
+    date_posted timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    date_edited timestamptz,
+    CONSTRAINT "RSO_Announcements_pk" PRIMARY KEY (announcement_id)
+);
+-- ddl-end --
+COMMENT ON COLUMN public."RSO_Announcements".body IS E'Markdown, rendered by the clients';
+-- ddl-end --
+-- object: announcements_by_rso | type: INDEX --
+-- DROP INDEX IF EXISTS public.announcements_by_rso CASCADE;
+CREATE INDEX announcements_by_rso ON public."RSO_Announcements" (rso_id, date_posted DESC);
+-- ddl-end --
+-- object: public."Announcement_Reads" | type: TABLE --
+-- DROP TABLE IF EXISTS public."Announcement_Reads" CASCADE;
+CREATE TABLE public."Announcement_Reads" (
+    announcement_id integer NOT NULL,
+    user_id integer NOT NULL,
+    read_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT "Announcement_Reads_pk" PRIMARY KEY (announcement_id, user_id)
+);
+-- ddl-end --
+-- object: public."Media" | type: TABLE --
+-- DROP TABLE IF EXISTS public."Media" CASCADE;
+CREATE TABLE public."Media" (
+    media_id serial NOT NULL,
+    storage_key varchar(64) NOT NULL,
+    content_type varchar(64) NOT NULL,
+    size_bytes integer NOT NULL,
+    width integer,
+    height integer,
+    thumb_key varchar(64),
+    thumb_type varchar(64),
+    etag char(64) NOT NULL,
+    uploaded_by integer,
+    date_uploaded timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT "Media_pk" PRIMARY KEY (media_id)
+);
+-- ddl-end --
+COMMENT ON TABLE public."Media" IS E'Uploaded files. The bytes live in the configured store, rows never change once written.';
+-- ddl-end --
+-- object: public."Media_Blobs" | type: TABLE --
+-- DROP TABLE IF EXISTS public."Media_Blobs" CASCADE;
+CREATE TABLE public."Media_Blobs" (
+    key varchar(64) NOT NULL,
+    data bytea NOT NULL,
+    content_type varchar(64) NOT NULL,
+    CONSTRAINT "Media_Blobs_pk" PRIMARY KEY (key)
+);
+-- ddl-end --
+COMMENT ON TABLE public."Media_Blobs" IS E'Bytes of the media when stored in Postgres (MEDIA_STORE=db, the default)';
+-- ddl-end --
+-- object: public."RSO_Admin_Transfers" | type: TABLE --
+-- DROP TABLE IF EXISTS public."RSO_Admin_Transfers" CASCADE;
+CREATE TABLE public."RSO_Admin_Transfers" (
+    rso_id integer NOT NULL,
+    from_user integer NOT NULL,
+    to_user integer NOT NULL,
+    date_requested timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT "RSO_Admin_Transfers_pk" PRIMARY KEY (rso_id)
+);
+-- ddl-end --
+-- object: public."Superadmin_Universities" | type: TABLE --
+-- DROP TABLE IF EXISTS public."Superadmin_Universities" CASCADE;
+CREATE TABLE public."Superadmin_Universities" (
+    user_id integer NOT NULL,
+    uni_id integer NOT NULL,
+    assigned_by integer,
+    date_assigned timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT "Superadmin_Universities_pk" PRIMARY KEY (user_id, uni_id)
+);
+-- ddl-end --
+-- object: public.invite_status | type: TYPE --
+-- DROP TYPE IF EXISTS public.invite_status CASCADE;
+CREATE TYPE public.invite_status AS ENUM ('pending', 'accepted', 'declined');
+-- ddl-end --
+-- object: public.app_status | type: TYPE --
+-- DROP TYPE IF EXISTS public.app_status CASCADE;
+CREATE TYPE public.app_status AS ENUM ('awaiting_founders', 'submitted', 'approved', 'rejected', 'withdrawn');
+-- ddl-end --
 -- object: public."RSO_Apps" | type: TABLE --
 -- DROP TABLE IF EXISTS public."RSO_Apps" CASCADE;
 CREATE TABLE public."RSO_Apps" (
@@ -120,10 +431,29 @@ CREATE TABLE public."RSO_Apps" (
     student2_id serial NOT NULL,
     student3_id serial NOT NULL,
     superadmin_approval boolean NOT NULL DEFAULT FALSE,
-    CONSTRAINT no_dupes UNIQUE NULLS NOT DISTINCT (name),
+    status public.app_status NOT NULL DEFAULT 'awaiting_founders',
+    date_submitted timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    reviewed_by integer,
+    review_note text,
     CONSTRAINT "RSO_Apps_pk" PRIMARY KEY (id)
 );
 -- ddl-end --
+-- A name is only taken while its application is still open or approved
+CREATE UNIQUE INDEX no_dupes ON public."RSO_Apps" (name)
+WHERE status NOT IN ('rejected', 'withdrawn');
+-- ddl-end --
+-- object: public."RSO_App_Founders" | type: TABLE --
+-- DROP TABLE IF EXISTS public."RSO_App_Founders" CASCADE;
+CREATE TABLE public."RSO_App_Founders" (
+    app_id integer NOT NULL,
+    user_id integer NOT NULL,
+    status public.invite_status NOT NULL DEFAULT 'pending',
+    date_responded timestamp with time zone,
+    CONSTRAINT "RSO_App_Founders_pk" PRIMARY KEY (app_id, user_id)
+);
+-- ddl-end --
+COMMENT ON TABLE public."RSO_App_Founders" IS E'Confirmation of each co-founder (student1-3) named on an RSO application';
+-- ddl-end --
 -- object: public."Event_Feedback" | type: TABLE --
 -- DROP TABLE IF EXISTS public."Event_Feedback" CASCADE;
 CREATE TABLE public."Event_Feedback" (
@@ -145,6 +475,8 @@ CREATE TABLE public."Event_Feedback" (
 CREATE TABLE public.user_event_membership (
     user_id int NOT NULL,
     event_id int NOT NULL,
+    -- Set when an organiser checks the user in at the event
+    checked_in_at timestamptz NULL,
     UNIQUE(user_id, event_id),
 
     CONSTRAINT fk_user
@@ -156,10 +488,73 @@ CREATE TABLE public.user_event_membership (
         REFERENCES public."Events" (event_id)
 );
 
+-- ddl-end --
+-- object: public."Event_Status_History" | type: TABLE --
+-- DROP TABLE IF EXISTS public."Event_Status_History" CASCADE;
+CREATE TABLE public."Event_Status_History" (
+    id serial NOT NULL,
+    event_id integer NOT NULL,
+    old_status public.event_status NOT NULL,
+    new_status public.event_status NOT NULL,
+    reason text,
+    changed_by integer,
+    changed_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT "Event_Status_History_pk" PRIMARY KEY (id)
+);
+-- ddl-end --
+COMMENT ON COLUMN public."Event_Status_History".changed_by IS E'NULL when the server changed the status, e.g. completing finished events';
+-- ddl-end --
+-- object: public.host_status | type: TYPE --
+-- DROP TYPE IF EXISTS public.host_status CASCADE;
+CREATE TYPE public.host_status AS ENUM ('pending', 'accepted', 'declined');
+-- ddl-end --
+-- object: public."Event_Hosts" | type: TABLE --
+-- DROP TABLE IF EXISTS public."Event_Hosts" CASCADE;
+CREATE TABLE public."Event_Hosts" (
+    event_id integer NOT NULL,
+    rso_id integer NOT NULL,
+    status public.host_status NOT NULL DEFAULT 'pending',
+    invited_by integer,
+    date_invited timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT "Event_Hosts_pk" PRIMARY KEY (event_id, rso_id)
+);
+-- ddl-end --
+COMMENT ON TABLE public."Event_Hosts" IS E'RSOs hosting an event. The creating RSO is inserted as accepted, co-hosts start as pending';
+-- ddl-end --
+-- object: public."Event_Invitations" | type: TABLE --
+-- DROP TABLE IF EXISTS public."Event_Invitations" CASCADE;
+CREATE TABLE public."Event_Invitations" (
+    inv_id serial NOT NULL,
+    event_id integer NOT NULL,
+    user_id integer NOT NULL,
+    invited_by integer,
+    status public.invite_status NOT NULL DEFAULT 'pending',
+    via_link boolean NOT NULL DEFAULT FALSE,
+    date_invited timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    date_responded timestamp with time zone,
+    CONSTRAINT "Event_Invitations_pk" PRIMARY KEY (inv_id),
+    CONSTRAINT one_invitation UNIQUE (event_id, user_id)
+);
+-- ddl-end --
+COMMENT ON COLUMN public."Event_Invitations".via_link IS E'The user answered through a shared invitation link instead of a direct invitation';
 -- ddl-end --
 -- object: public.validate_non_overlapping_events | type: FUNCTION --
 -- DROP FUNCTION IF EXISTS public.validate_non_overlapping_events() CASCADE;
-CREATE FUNCTION public.validate_non_overlapping_events() RETURNS trigger LANGUAGE plpgsql AS $$ BEGIN IF EXISTS (
+CREATE FUNCTION public.validate_non_overlapping_events() RETURNS trigger LANGUAGE plpgsql AS $$ BEGIN
+-- Cancelled events don't hold on to their time slot, and online events
+-- book no room
+IF NEW.status = 'cancelled'
+OR NEW.loc_id IS NULL THEN RETURN NEW;
+END IF;
+-- Updates that keep the times and the room (e.g. status changes) were
+-- already checked
+IF TG_OP = 'UPDATE'
+AND NEW.start_time = OLD.start_time
+AND NEW.end_time = OLD.end_time
+AND NEW.loc_id IS NOT DISTINCT FROM OLD.loc_id
+AND OLD.status <> 'cancelled' THEN RETURN NEW;
+END IF;
+IF EXISTS (
     SELECT 1
     FROM public."Events" ev
     WHERE (
@@ -177,8 +572,10 @@ CREATE FUNCTION public.validate_non_overlapping_events() RETURNS trigger LANGUAG
                 AND NEW.end_time <= ev.end_time
             )
         )
+        AND ev.loc_id = NEW.loc_id -- Only events booking the same room
+        AND ev.status <> 'cancelled'
         AND ev.event_id <> NEW.event_id -- Exclude the event being inserted/updated
-) THEN RAISE EXCEPTION 'Event conflicts with existing event times';
+) THEN RAISE EXCEPTION 'The room is already booked at that time';
 END IF;
 RETURN NEW;
 END;
@@ -192,7 +589,7 @@ INSERT ON public."Events" FOR EACH ROW EXECUTE PROCEDURE public.validate_non_ove
 -- object: validate_before_update | type: TRIGGER --
 -- DROP TRIGGER IF EXISTS validate_before_update ON public."Events" CASCADE;
 CREATE TRIGGER validate_before_update BEFORE
-UPDATE ON public."Events" FOR EACH STATEMENT EXECUTE PROCEDURE public.validate_non_overlapping_events();
+UPDATE ON public."Events" FOR EACH ROW EXECUTE PROCEDURE public.validate_non_overlapping_events();
 -- ddl-end --
 -- object: public.validate_admin_association | type: FUNCTION --
 -- DROP FUNCTION IF EXISTS public.validate_admin_association() CASCADE;
@@ -200,7 +597,8 @@ CREATE FUNCTION public.validate_admin_association() RETURNS trigger LANGUAGE plp
     SELECT 1
     FROM public."User_RSO_Membership"
     WHERE user_id = NEW.user_id
-) THEN RAISE EXCEPTION 'Admin must be associated with at least one RSO';
+        AND role = 'admin'
+) THEN RAISE EXCEPTION 'Admin must be the admin of at least one RSO';
 END IF;
 END IF;
 RETURN NEW;
@@ -251,6 +649,56 @@ INSERT
     OR
 UPDATE ON public."Users" FOR EACH ROW EXECUTE PROCEDURE public.update_student_count();
 -- ddl-end --
+-- object: public.refresh_rso_active | type: FUNCTION --
+-- DROP FUNCTION IF EXISTS public.refresh_rso_active() CASCADE;
+CREATE OR REPLACE FUNCTION public.refresh_rso_active () RETURNS trigger LANGUAGE plpgsql VOLATILE CALLED ON NULL INPUT SECURITY INVOKER PARALLEL UNSAFE COST 1 AS $$
+DECLARE changed_rso integer;
+BEGIN
+IF TG_OP = 'DELETE' THEN changed_rso := OLD.rso_id;
+ELSE changed_rso := NEW.rso_id;
+END IF;
+UPDATE public."RSOs" r
+SET active = (
+        SELECT COUNT(*)
+        FROM public."User_RSO_Membership" m
+        WHERE m.rso_id = r.rso_id
+    ) >= (
+        SELECT u.min_rso_members
+        FROM public."Universities" u
+        WHERE u.uni_id = r.uni_id
+    )
+WHERE r.rso_id = changed_rso;
+RETURN NULL;
+END;
+$$;
+-- ddl-end --
+-- object: refresh_rso_active | type: TRIGGER --
+-- DROP TRIGGER IF EXISTS refresh_rso_active ON public."User_RSO_Membership" CASCADE;
+CREATE TRIGGER refresh_rso_active
+AFTER
+INSERT
+    OR DELETE ON public."User_RSO_Membership" FOR EACH ROW EXECUTE PROCEDURE public.refresh_rso_active();
+-- ddl-end --
+-- object: public.update_rso_active_threshold | type: FUNCTION --
+-- DROP FUNCTION IF EXISTS public.update_rso_active_threshold() CASCADE;
+CREATE OR REPLACE FUNCTION public.update_rso_active_threshold () RETURNS trigger LANGUAGE plpgsql VOLATILE CALLED ON NULL INPUT SECURITY INVOKER PARALLEL UNSAFE COST 1 AS $$ BEGIN
+UPDATE public."RSOs" r
+SET active = (
+        SELECT COUNT(*)
+        FROM public."User_RSO_Membership" m
+        WHERE m.rso_id = r.rso_id
+    ) >= NEW.min_rso_members
+WHERE r.uni_id = NEW.uni_id;
+RETURN NULL;
+END;
+$$;
+-- ddl-end --
+-- object: update_rso_active_threshold | type: TRIGGER --
+-- DROP TRIGGER IF EXISTS update_rso_active_threshold ON public."Universities" CASCADE;
+CREATE TRIGGER update_rso_active_threshold
+AFTER
+UPDATE OF min_rso_members ON public."Universities" FOR EACH ROW EXECUTE PROCEDURE public.update_rso_active_threshold();
+-- ddl-end --
 -- object: uni_id | type: CONSTRAINT --
 -- ALTER TABLE public."Users" DROP CONSTRAINT IF EXISTS uni_id CASCADE;
 ALTER TABLE public."Users"
@@ -281,11 +729,20 @@ ALTER TABLE public."Events"
 ADD CONSTRAINT rso FOREIGN KEY (rso_id) REFERENCES public."RSOs" (rso_id) MATCH SIMPLE ON DELETE
 SET NULL ON UPDATE CASCADE;
 -- ddl-end --
+-- object: parent_location | type: CONSTRAINT --
+-- ALTER TABLE public."Locations" DROP CONSTRAINT IF EXISTS parent_location CASCADE;
+ALTER TABLE public."Locations"
+ADD CONSTRAINT parent_location FOREIGN KEY (parent_id) REFERENCES public."Locations" (loc_id) MATCH SIMPLE ON DELETE RESTRICT ON UPDATE CASCADE;
+-- ddl-end --
+-- object: gazetteer_uni | type: CONSTRAINT --
+-- ALTER TABLE public."Gazetteer" DROP CONSTRAINT IF EXISTS gazetteer_uni CASCADE;
+ALTER TABLE public."Gazetteer"
+ADD CONSTRAINT gazetteer_uni FOREIGN KEY (uni_id) REFERENCES public."Universities" (uni_id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+-- ddl-end --
 -- object: loc | type: CONSTRAINT --
 -- ALTER TABLE public."Events" DROP CONSTRAINT IF EXISTS loc CASCADE;
 ALTER TABLE public."Events"
-ADD CONSTRAINT loc FOREIGN KEY (loc_id) REFERENCES public."Locations" (loc_id) MATCH SIMPLE ON DELETE
-SET NULL ON UPDATE CASCADE;
+ADD CONSTRAINT loc FOREIGN KEY (loc_id) REFERENCES public."Locations" (loc_id) MATCH SIMPLE ON DELETE RESTRICT ON UPDATE CASCADE;
 -- ddl-end --
 -- object: "user" | type: CONSTRAINT --
 -- ALTER TABLE public."User_RSO_Membership" DROP CONSTRAINT IF EXISTS "user" CASCADE;
@@ -336,6 +793,376 @@ ADD CONSTRAINT "user" FOREIGN KEY (user_id) REFERENCES public."Users" (user_id)
 ALTER TABLE public."Event_Feedback"
 ADD CONSTRAINT event FOREIGN KEY (event_id) REFERENCES public."Events" (event_id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
 -- ddl-end --
--- Add Online Location for Usage
-INSERT INTO public."Locations" (address, latitude, longitude)
-VALUES ('Online', 'o', 'o');
\ No newline at end of file
+-- object: event | type: CONSTRAINT --
+-- ALTER TABLE public."Event_Hosts" DROP CONSTRAINT IF EXISTS event CASCADE;
+ALTER TABLE public."Event_Hosts"
+ADD CONSTRAINT event FOREIGN KEY (event_id) REFERENCES public."Events" (event_id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+-- ddl-end --
+-- object: rso | type: CONSTRAINT --
+-- ALTER TABLE public."Event_Hosts" DROP CONSTRAINT IF EXISTS rso CASCADE;
+ALTER TABLE public."Event_Hosts"
+ADD CONSTRAINT rso FOREIGN KEY (rso_id) REFERENCES public."RSOs" (rso_id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+-- ddl-end --
+-- object: inviter | type: CONSTRAINT --
+-- ALTER TABLE public."Event_Hosts" DROP CONSTRAINT IF EXISTS inviter CASCADE;
+ALTER TABLE public."Event_Hosts"
+ADD CONSTRAINT inviter FOREIGN KEY (invited_by) REFERENCES public."Users" (user_id) MATCH SIMPLE ON DELETE
+SET NULL ON UPDATE CASCADE;
+-- ddl-end --
+-- object: creator | type: CONSTRAINT --
+-- ALTER TABLE public."Events" DROP CONSTRAINT IF EXISTS creator CASCADE;
+ALTER TABLE public."Events"
+ADD CONSTRAINT creator FOREIGN KEY (created_by) REFERENCES public."Users" (user_id) MATCH SIMPLE ON DELETE
+SET NULL ON UPDATE CASCADE;
+-- ddl-end --
+-- object: event | type: CONSTRAINT --
+-- ALTER TABLE public."Event_Invitations" DROP CONSTRAINT IF EXISTS event CASCADE;
+ALTER TABLE public."Event_Invitations"
+ADD CONSTRAINT event FOREIGN KEY (event_id) REFERENCES public."Events" (event_id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+-- ddl-end --
+-- object: "user" | type: CONSTRAINT --
+-- ALTER TABLE public."Event_Invitations" DROP CONSTRAINT IF EXISTS "user" CASCADE;
+ALTER TABLE public."Event_Invitations"
+ADD CONSTRAINT "user" FOREIGN KEY (user_id) REFERENCES public."Users" (user_id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+-- ddl-end --
+-- object: inviter | type: CONSTRAINT --
+-- ALTER TABLE public."Event_Invitations" DROP CONSTRAINT IF EXISTS inviter CASCADE;
+ALTER TABLE public."Event_Invitations"
+ADD CONSTRAINT inviter FOREIGN KEY (invited_by) REFERENCES public."Users" (user_id) MATCH SIMPLE ON DELETE
+SET NULL ON UPDATE CASCADE;
+-- ddl-end --
+-- object: event | type: CONSTRAINT --
+-- ALTER TABLE public."Event_Status_History" DROP CONSTRAINT IF EXISTS event CASCADE;
+ALTER TABLE public."Event_Status_History"
+ADD CONSTRAINT event FOREIGN KEY (event_id) REFERENCES public."Events" (event_id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+-- ddl-end --
+-- object: changer | type: CONSTRAINT --
+-- ALTER TABLE public."Event_Status_History" DROP CONSTRAINT IF EXISTS changer CASCADE;
+ALTER TABLE public."Event_Status_History"
+ADD CONSTRAINT changer FOREIGN KEY (changed_by) REFERENCES public."Users" (user_id) MATCH SIMPLE ON DELETE
+SET NULL ON UPDATE CASCADE;
+-- ddl-end --
+-- object: app | type: CONSTRAINT --
+-- ALTER TABLE public."RSO_App_Founders" DROP CONSTRAINT IF EXISTS app CASCADE;
+ALTER TABLE public."RSO_App_Founders"
+ADD CONSTRAINT app FOREIGN KEY (app_id) REFERENCES public."RSO_Apps" (id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+-- ddl-end --
+-- object: "user" | type: CONSTRAINT --
+-- ALTER TABLE public."RSO_App_Founders" DROP CONSTRAINT IF EXISTS "user" CASCADE;
+ALTER TABLE public."RSO_App_Founders"
+ADD CONSTRAINT "user" FOREIGN KEY (user_id) REFERENCES public."Users" (user_id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+-- ddl-end --
+-- object: reviewer | type: CONSTRAINT --
+-- ALTER TABLE public."RSO_Apps" DROP CONSTRAINT IF EXISTS reviewer CASCADE;
+ALTER TABLE public."RSO_Apps"
+ADD CONSTRAINT reviewer FOREIGN KEY (reviewed_by) REFERENCES public."Users" (user_id) MATCH SIMPLE ON DELETE
+SET NULL ON UPDATE CASCADE;
+-- ddl-end --
+-- object: transfer_rso | type: CONSTRAINT --
+-- ALTER TABLE public."RSO_Admin_Transfers" DROP CONSTRAINT IF EXISTS transfer_rso CASCADE;
+ALTER TABLE public."RSO_Admin_Transfers"
+ADD CONSTRAINT transfer_rso FOREIGN KEY (rso_id) REFERENCES public."RSOs" (rso_id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+-- ddl-end --
+-- object: transfer_from | type: CONSTRAINT --
+-- ALTER TABLE public."RSO_Admin_Transfers" DROP CONSTRAINT IF EXISTS transfer_from CASCADE;
+ALTER TABLE public."RSO_Admin_Transfers"
+ADD CONSTRAINT transfer_from FOREIGN KEY (from_user) REFERENCES public."Users" (user_id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+-- ddl-end --
+-- object: transfer_to | type: CONSTRAINT --
+-- ALTER TABLE public."RSO_Admin_Transfers" DROP CONSTRAINT IF EXISTS transfer_to CASCADE;
+ALTER TABLE public."RSO_Admin_Transfers"
+ADD CONSTRAINT transfer_to FOREIGN KEY (to_user) REFERENCES public."Users" (user_id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+-- ddl-end --
+-- object: join_rso | type: CONSTRAINT --
+-- ALTER TABLE public."RSO_Join_Requests" DROP CONSTRAINT IF EXISTS join_rso CASCADE;
+ALTER TABLE public."RSO_Join_Requests"
+ADD CONSTRAINT join_rso FOREIGN KEY (rso_id) REFERENCES public."RSOs" (rso_id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+-- ddl-end --
+-- object: join_user | type: CONSTRAINT --
+-- ALTER TABLE public."RSO_Join_Requests" DROP CONSTRAINT IF EXISTS join_user CASCADE;
+ALTER TABLE public."RSO_Join_Requests"
+ADD CONSTRAINT join_user FOREIGN KEY (user_id) REFERENCES public."Users" (user_id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+-- ddl-end --
+-- object: join_reviewer | type: CONSTRAINT --
+-- ALTER TABLE public."RSO_Join_Requests" DROP CONSTRAINT IF EXISTS join_reviewer CASCADE;
+ALTER TABLE public."RSO_Join_Requests"
+ADD CONSTRAINT join_reviewer FOREIGN KEY (reviewed_by) REFERENCES public."Users" (user_id) MATCH SIMPLE ON DELETE
+SET NULL ON UPDATE CASCADE;
+-- ddl-end --
+-- object: announcement_rso | type: CONSTRAINT --
+-- ALTER TABLE public."RSO_Announcements" DROP CONSTRAINT IF EXISTS announcement_rso CASCADE;
+ALTER TABLE public."RSO_Announcements"
+ADD CONSTRAINT announcement_rso FOREIGN KEY (rso_id) REFERENCES public."RSOs" (rso_id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+-- ddl-end --
+-- object: announcement_author | type: CONSTRAINT --
+-- ALTER TABLE public."RSO_Announcements" DROP CONSTRAINT IF EXISTS announcement_author CASCADE;
+ALTER TABLE public."RSO_Announcements"
+ADD CONSTRAINT announcement_author FOREIGN KEY (author_id) REFERENCES public."Users" (user_id) MATCH SIMPLE ON DELETE
+SET NULL ON UPDATE CASCADE;
+-- ddl-end --
+-- object: read_announcement | type: CONSTRAINT --
+-- ALTER TABLE public."Announcement_Reads" DROP CONSTRAINT IF EXISTS read_announcement CASCADE;
+ALTER TABLE public."Announcement_Reads"
+ADD CONSTRAINT read_announcement FOREIGN KEY (announcement_id) REFERENCES public."RSO_Announcements" (announcement_id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+-- ddl-end --
+-- object: read_user | type: CONSTRAINT --
+-- ALTER TABLE public."Announcement_Reads" DROP CONSTRAINT IF EXISTS read_user CASCADE;
+ALTER TABLE public."Announcement_Reads"
+ADD CONSTRAINT read_user FOREIGN KEY (user_id) REFERENCES public."Users" (user_id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+-- ddl-end --
+-- object: media_uploader | type: CONSTRAINT --
+-- ALTER TABLE public."Media" DROP CONSTRAINT IF EXISTS media_uploader CASCADE;
+ALTER TABLE public."Media"
+ADD CONSTRAINT media_uploader FOREIGN KEY (uploaded_by) REFERENCES public."Users" (user_id) MATCH SIMPLE ON DELETE
+SET NULL ON UPDATE CASCADE;
+-- ddl-end --
+-- object: logo | type: CONSTRAINT --
+-- ALTER TABLE public."RSOs" DROP CONSTRAINT IF EXISTS logo CASCADE;
+ALTER TABLE public."RSOs"
+ADD CONSTRAINT logo FOREIGN KEY (logo_id) REFERENCES public."Media" (media_id) MATCH SIMPLE ON DELETE
+SET NULL ON UPDATE CASCADE;
+-- ddl-end --
+-- object: uni_picture | type: CONSTRAINT --
+-- ALTER TABLE public."Universities" DROP CONSTRAINT IF EXISTS uni_picture CASCADE;
+ALTER TABLE public."Universities"
+ADD CONSTRAINT uni_picture FOREIGN KEY (picture_id) REFERENCES public."Media" (media_id) MATCH SIMPLE ON DELETE
+SET NULL ON UPDATE CASCADE;
+-- ddl-end --
+-- object: superadmin_user | type: CONSTRAINT --
+-- ALTER TABLE public."Superadmin_Universities" DROP CONSTRAINT IF EXISTS superadmin_user CASCADE;
+ALTER TABLE public."Superadmin_Universities"
+ADD CONSTRAINT superadmin_user FOREIGN KEY (user_id) REFERENCES public."Users" (user_id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+-- ddl-end --
+-- object: superadmin_uni | type: CONSTRAINT --
+-- ALTER TABLE public."Superadmin_Universities" DROP CONSTRAINT IF EXISTS superadmin_uni CASCADE;
+ALTER TABLE public."Superadmin_Universities"
+ADD CONSTRAINT superadmin_uni FOREIGN KEY (uni_id) REFERENCES public."Universities" (uni_id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+-- ddl-end --
+-- object: superadmin_assigned_by | type: CONSTRAINT --
+-- ALTER TABLE public."Superadmin_Universities" DROP CONSTRAINT IF EXISTS superadmin_assigned_by CASCADE;
+ALTER TABLE public."Superadmin_Universities"
+ADD CONSTRAINT superadmin_assigned_by FOREIGN KEY (assigned_by) REFERENCES public."Users" (user_id) MATCH SIMPLE ON DELETE
+SET NULL ON UPDATE CASCADE;
+-- ddl-end --
+-- Row-level security
+-- The server runs the queries of a request as knightlink_app inside a
+-- transaction that sets app.user_id, app.uni_id, app.user_type and
+-- app.platform_admin (see internal/handlers/tenant.go). The policies below
+-- only apply to that role, the owner of the tables is not affected.
+-- object: knightlink_app | type: ROLE --
+DO $$ BEGIN IF NOT EXISTS (
+    SELECT 1
+    FROM pg_roles
+    WHERE rolname = 'knightlink_app'
+) THEN CREATE ROLE knightlink_app NOLOGIN;
+END IF;
+END $$;
+GRANT knightlink_app TO CURRENT_USER;
+GRANT USAGE ON SCHEMA public TO knightlink_app;
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO knightlink_app;
+GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO knightlink_app;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO knightlink_app;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT USAGE, SELECT ON SEQUENCES TO knightlink_app;
+-- ddl-end --
+-- object: public.app_user_id | type: FUNCTION --
+-- DROP FUNCTION IF EXISTS public.app_user_id() CASCADE;
+CREATE FUNCTION public.app_user_id() RETURNS integer LANGUAGE sql STABLE AS $$
+SELECT NULLIF(current_setting('app.user_id', true), '')::integer $$;
+-- ddl-end --
+-- object: public.app_uni_id | type: FUNCTION --
+-- DROP FUNCTION IF EXISTS public.app_uni_id() CASCADE;
+CREATE FUNCTION public.app_uni_id() RETURNS integer LANGUAGE sql STABLE AS $$
+SELECT NULLIF(current_setting('app.uni_id', true), '')::integer $$;
+-- ddl-end --
+-- The functions below read other tables with the rights of their owner, so
+-- policies can use them without recursing into each other
+-- object: public.app_superadmin_of | type: FUNCTION --
+-- DROP FUNCTION IF EXISTS public.app_superadmin_of(integer) CASCADE;
+CREATE FUNCTION public.app_superadmin_of(uni integer) RETURNS boolean LANGUAGE sql STABLE SECURITY DEFINER
+SET search_path = public AS $$
+SELECT COALESCE(current_setting('app.user_type', true), '') = 'superadmin'
+    AND (
+        COALESCE(current_setting('app.platform_admin', true), '') = 'true'
+        OR EXISTS (
+            SELECT 1
+            FROM public."Superadmin_Universities"
+            WHERE user_id = public.app_user_id()
+                AND uni_id = uni
+        )
+    ) $$;
+-- ddl-end --
+-- object: public.app_rso_uni | type: FUNCTION --
+-- DROP FUNCTION IF EXISTS public.app_rso_uni(integer) CASCADE;
+CREATE FUNCTION public.app_rso_uni(rso integer) RETURNS integer LANGUAGE sql STABLE SECURITY DEFINER
+SET search_path = public AS $$
+SELECT uni_id
+FROM public."RSOs"
+WHERE rso_id = rso $$;
+-- ddl-end --
+-- Same rules as visibleEventClause in internal/handlers/handlers.go, plus
+-- the superadmins of the event's university
+-- object: public.app_can_see_event | type: FUNCTION --
+-- DROP FUNCTION IF EXISTS public.app_can_see_event(integer) CASCADE;
+CREATE FUNCTION public.app_can_see_event(event integer) RETURNS boolean LANGUAGE sql STABLE SECURITY DEFINER
+SET search_path = public AS $$
+SELECT EXISTS (
+        SELECT 1
+        FROM public."Events" e
+        WHERE e.event_id = event
+            AND (
+                public.app_superadmin_of(e.uni_id)
+                OR e.visibility = 'public'
+                OR (
+                    e.visibility <> 'invite_only'
+                    AND (
+                        e.uni_id = public.app_uni_id()
+                        OR e.rso_id IN (
+                            SELECT rso_id
+                            FROM public."User_RSO_Membership"
+                            WHERE user_id = public.app_user_id()
+                        )
+                        OR EXISTS (
+                            SELECT 1
+                            FROM public."Event_Hosts" h
+                                JOIN public."User_RSO_Membership" m ON m.rso_id = h.rso_id
+                            WHERE h.event_id = e.event_id
+                                AND h.status = 'accepted'
+                                AND m.user_id = public.app_user_id()
+                        )
+                    )
+                )
+                OR (
+                    e.visibility = 'invite_only'
+                    AND (
+                        e.created_by = public.app_user_id()
+                        OR EXISTS (
+                            SELECT 1
+                            FROM public."Event_Hosts" h
+                                JOIN public."RSOs" r ON r.rso_id = h.rso_id
+                            WHERE h.event_id = e.event_id
+                                AND h.status = 'accepted'
+                                AND r.admin_id = public.app_user_id()
+                        )
+                        OR EXISTS (
+                            SELECT 1
+                            FROM public."Event_Invitations" i
+                            WHERE i.event_id = e.event_id
+                                AND i.user_id = public.app_user_id()
+                                AND i.status <> 'declined'
+                        )
+                    )
+                )
+            )
+    ) $$;
+-- ddl-end --
+-- RSOs of other universities show up as hosts of public events and to
+-- their members
+-- object: public.app_can_see_rso | type: FUNCTION --
+-- DROP FUNCTION IF EXISTS public.app_can_see_rso(integer) CASCADE;
+CREATE FUNCTION public.app_can_see_rso(rso integer) RETURNS boolean LANGUAGE sql STABLE SECURITY DEFINER
+SET search_path = public AS $$
+SELECT EXISTS (
+        SELECT 1
+        FROM public."User_RSO_Membership"
+        WHERE rso_id = rso
+            AND user_id = public.app_user_id()
+    )
+    OR EXISTS (
+        SELECT 1
+        FROM public."Events" e
+        WHERE e.visibility = 'public'
+            AND (
+                e.rso_id = rso
+                OR EXISTS (
+                    SELECT 1
+                    FROM public."Event_Hosts" h
+                    WHERE h.event_id = e.event_id
+                        AND h.rso_id = rso
+                        AND h.status = 'accepted'
+                )
+            )
+    ) $$;
+-- ddl-end --
+ALTER TABLE public."Events" ENABLE ROW LEVEL SECURITY;
+ALTER TABLE public."User_RSO_Membership" ENABLE ROW LEVEL SECURITY;
+ALTER TABLE public.user_event_membership ENABLE ROW LEVEL SECURITY;
+ALTER TABLE public."Event_Feedback" ENABLE ROW LEVEL SECURITY;
+-- ddl-end --
+-- object: users_visible | type: POLICY --
+-- DROP POLICY IF EXISTS users_visible ON public."Users" CASCADE;
+CREATE POLICY users_visible ON public."Users" FOR SELECT TO knightlink_app USING (
+    user_id = public.app_user_id()
+    OR uni_id = public.app_uni_id()
+    OR public.app_superadmin_of(uni_id)
+);
+-- ddl-end --
+-- object: users_self | type: POLICY --
+-- DROP POLICY IF EXISTS users_self ON public."Users" CASCADE;
+CREATE POLICY users_self ON public."Users" FOR UPDATE TO knightlink_app USING (user_id = public.app_user_id());
+-- ddl-end --
+-- object: rsos_tenant | type: POLICY --
+-- DROP POLICY IF EXISTS rsos_tenant ON public."RSOs" CASCADE;
+CREATE POLICY rsos_tenant ON public."RSOs" FOR ALL TO knightlink_app USING (
+    uni_id = public.app_uni_id()
+    OR public.app_superadmin_of(uni_id)
+);
+-- ddl-end --
+-- object: rsos_visible | type: POLICY --
+-- DROP POLICY IF EXISTS rsos_visible ON public."RSOs" CASCADE;
+CREATE POLICY rsos_visible ON public."RSOs" FOR SELECT TO knightlink_app USING (public.app_can_see_rso(rso_id));
+-- ddl-end --
+-- object: events_visible | type: POLICY --
+-- DROP POLICY IF EXISTS events_visible ON public."Events" CASCADE;
+CREATE POLICY events_visible ON public."Events" FOR SELECT TO knightlink_app USING (public.app_can_see_event(event_id));
+-- ddl-end --
+-- object: events_insert | type: POLICY --
+-- DROP POLICY IF EXISTS events_insert ON public."Events" CASCADE;
+CREATE POLICY events_insert ON public."Events" FOR INSERT TO knightlink_app WITH CHECK (
+    uni_id = public.app_uni_id()
+    OR public.app_superadmin_of(uni_id)
+);
+-- ddl-end --
+-- object: events_update | type: POLICY --
+-- DROP POLICY IF EXISTS events_update ON public."Events" CASCADE;
+CREATE POLICY events_update ON public."Events" FOR UPDATE TO knightlink_app USING (
+    uni_id = public.app_uni_id()
+    OR public.app_superadmin_of(uni_id)
+);
+-- ddl-end --
+-- object: events_delete | type: POLICY --
+-- DROP POLICY IF EXISTS events_delete ON public."Events" CASCADE;
+CREATE POLICY events_delete ON public."Events" FOR DELETE TO knightlink_app USING (
+    uni_id = public.app_uni_id()
+    OR public.app_superadmin_of(uni_id)
+);
+-- ddl-end --
+-- object: memberships_tenant | type: POLICY --
+-- DROP POLICY IF EXISTS memberships_tenant ON public."User_RSO_Membership" CASCADE;
+CREATE POLICY memberships_tenant ON public."User_RSO_Membership" FOR ALL TO knightlink_app USING (
+    user_id = public.app_user_id()
+    OR public.app_rso_uni(rso_id) = public.app_uni_id()
+    OR public.app_superadmin_of(public.app_rso_uni(rso_id))
+);
+-- ddl-end --
+-- object: attendance_visible | type: POLICY --
+-- DROP POLICY IF EXISTS attendance_visible ON public.user_event_membership CASCADE;
+CREATE POLICY attendance_visible ON public.user_event_membership FOR SELECT TO knightlink_app USING (public.app_can_see_event(event_id));
+-- ddl-end --
+-- object: attendance_own | type: POLICY --
+-- DROP POLICY IF EXISTS attendance_own ON public.user_event_membership CASCADE;
+CREATE POLICY attendance_own ON public.user_event_membership FOR ALL TO knightlink_app USING (user_id = public.app_user_id()) WITH CHECK (
+    user_id = public.app_user_id()
+    AND public.app_can_see_event(event_id)
+);
+-- ddl-end --
+-- object: feedback_visible | type: POLICY --
+-- DROP POLICY IF EXISTS feedback_visible ON public."Event_Feedback" CASCADE;
+CREATE POLICY feedback_visible ON public."Event_Feedback" FOR SELECT TO knightlink_app USING (public.app_can_see_event(event_id));
+-- ddl-end --
+-- object: feedback_own | type: POLICY --
+-- DROP POLICY IF EXISTS feedback_own ON public."Event_Feedback" CASCADE;
+CREATE POLICY feedback_own ON public."Event_Feedback" FOR ALL TO knightlink_app USING (user_id = public.app_user_id()) WITH CHECK (
+    user_id = public.app_user_id()
+    AND public.app_can_see_event(event_id)
+);
+-- ddl-end --
@@ -0,0 +1,111 @@
+package geocode
+
+import (
+	"context"
+	"database/sql"
+)
+
+const (
+	maxPlaces = 5
+	// Reverse lookups only name places this close, in metres
+	reverseRadius = 500
+)
+
+// Gazetteer looks places up in the Gazetteer table, which each university
+// fills with its own buildings. Open is called for every lookup, the way the
+// handlers connect.
+type Gazetteer struct {
+	Open func() (*sql.DB, error)
+}
+
+func (g Gazetteer) Forward(ctx context.Context, uniId int, address string) ([]Place, error) {
+	db, err := g.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `SELECT name, COALESCE(address, ''), latitude, longitude,
+			GREATEST(similarity(normalized_name, public.normalize_address($2)),
+				COALESCE(similarity(normalized_address, public.normalize_address($2)), 0)) AS score, 0
+			FROM public."Gazetteer"
+			WHERE ($1 = 0 OR uni_id = $1)
+			AND (normalized_name % public.normalize_address($2) OR normalized_address % public.normalize_address($2))
+			ORDER BY score DESC
+			LIMIT $3`
+
+	return queryPlaces(ctx, db, query, uniId, address, maxPlaces)
+}
+
+func (g Gazetteer) Reverse(ctx context.Context, uniId int, lat float64, lng float64) ([]Place, error) {
+	db, err := g.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `SELECT name, COALESCE(address, ''), latitude, longitude, 0,
+			earth_distance(ll_to_earth($2, $3), ll_to_earth(latitude, longitude)) AS distance
+			FROM public."Gazetteer"
+			WHERE ($1 = 0 OR uni_id = $1)
+			AND earth_box(ll_to_earth($2, $3), $4) @> ll_to_earth(latitude, longitude)
+			AND earth_distance(ll_to_earth($2, $3), ll_to_earth(latitude, longitude)) <= $4
+			ORDER BY distance
+			LIMIT $5`
+
+	return queryPlaces(ctx, db, query, uniId, lat, lng, reverseRadius, maxPlaces)
+}
+
+func queryPlaces(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]Place, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	places := []Place{}
+	for rows.Next() {
+		var p Place
+		if err = rows.Scan(&p.Name, &p.Address, &p.Latitude, &p.Longitude, &p.Score, &p.Distance); err != nil {
+			return nil, err
+		}
+		places = append(places, p)
+	}
+
+	return places, rows.Err()
+}
+
+// Adds the places to the university's gazetteer, updating those it already
+// has by name. With replace the entries missing from places are removed.
+// Returns how many places were written.
+func (g Gazetteer) Import(ctx context.Context, uniId int, places []Place, replace bool) (int, error) {
+	db, err := g.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err = tx.ExecContext(ctx, `DELETE FROM public."Gazetteer" WHERE uni_id = $1`, uniId); err != nil {
+			return 0, err
+		}
+	}
+
+	query := `INSERT INTO public."Gazetteer" (uni_id, name, address, latitude, longitude)
+			VALUES ($1, $2, NULLIF($3, ''), $4, $5)
+			ON CONFLICT (uni_id, normalized_name) DO UPDATE
+			SET name = EXCLUDED.name, address = EXCLUDED.address, latitude = EXCLUDED.latitude, longitude = EXCLUDED.longitude`
+	for _, p := range places {
+		if _, err = tx.ExecContext(ctx, query, uniId, p.Name, p.Address, p.Latitude, p.Longitude); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(places), tx.Commit()
+}
@@ -0,0 +1,27 @@
+// Package geocode turns addresses into coordinates and back.
+package geocode
+
+import (
+	"context"
+)
+
+// A named place with its position
+type Place struct {
+	Name      string  `json:"name"`
+	Address   string  `json:"address"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// How well the place matches the address, from 0 to 1
+	Score float64 `json:"score,omitempty"`
+	// How far the place is from the point of a reverse lookup
+	Distance float64 `json:"distance_m,omitempty"`
+}
+
+// Anything that can look places up, e.g. the local gazetteer or a remote
+// service. uniId narrows the lookup down to a campus, 0 for all of them.
+type Geocoder interface {
+	// The places matching the address, best match first
+	Forward(ctx context.Context, uniId int, address string) ([]Place, error)
+	// The places around the point, closest first
+	Reverse(ctx context.Context, uniId int, lat float64, lng float64) ([]Place, error)
+}
@@ -0,0 +1,35 @@
+package geocode
+
+import (
+	"regexp"
+	"strings"
+)
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// In the order public.normalize_address applies them
+var abbreviations = [][2]string{
+	{"st", "street"},
+	{"ave", "avenue"},
+	{"rd", "road"},
+	{"dr", "drive"},
+	{"blvd", "boulevard"},
+	{"ln", "lane"},
+	{"bldg", "building"},
+	{"rm", "room"},
+	{"fl", "floor"},
+	{"ctr", "center"},
+	{"centre", "center"},
+	{"univ", "university"},
+}
+
+// Normalize does what public.normalize_address does in the database: lower
+// case, punctuation as spaces and the usual abbreviations spelled out, so
+// that names which compare equal there compare equal here too
+func Normalize(address string) string {
+	result := " " + nonAlphanumeric.ReplaceAllString(strings.ToLower(address), " ") + " "
+	for _, abbreviation := range abbreviations {
+		result = strings.ReplaceAll(result, " "+abbreviation[0]+" ", " "+abbreviation[1]+" ")
+	}
+	return strings.Join(strings.Fields(result), " ")
+}
@@ -0,0 +1,66 @@
+package geocode
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+var normalizeTests = []struct {
+	address string
+	want    string
+}{
+	{"", ""},
+	{"   ", ""},
+	{"Bldg. 1, N. Orange Ave", "building 1 n orange avenue"},
+	{"building 1 n orange avenue", "building 1 n orange avenue"},
+	{"12800 Pegasus Dr.", "12800 pegasus drive"},
+	{"Student Union Rm 218", "student union room 218"},
+	{"Health Centre", "health center"},
+	{"Rec Ctr", "rec center"},
+	{"Univ. Blvd", "university boulevard"},
+	{"St. Cloud St", "street cloud street"},
+	// Only whole words are spelled out
+	{"Stadium Drive-In", "stadium drive in"},
+	{"Avenue Q", "avenue q"},
+	// Replacements do not overlap, as with replace() in SQL
+	{"st st st", "street st street"},
+	{"Café Europa", "caf europa"},
+	{"HEC-101", "hec 101"},
+}
+
+func TestNormalize(t *testing.T) {
+	for _, tt := range normalizeTests {
+		if got := Normalize(tt.address); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.address, got, tt.want)
+		}
+	}
+}
+
+// Normalize must agree with public.normalize_address, which the unique
+// gazetteer names are built on. Needs the database the handlers' tests use.
+func TestNormalizeMatchesDatabase(t *testing.T) {
+	if os.Getenv("PG_DB") == "" {
+		t.Skip("PG_DB is not set, skipping the database tests")
+	}
+
+	db, err := sql.Open("postgres", fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		"localhost", 5432, os.Getenv("PG_USER"), os.Getenv("PG_PW"), os.Getenv("PG_DB")))
+	if err != nil {
+		t.Fatalf("connecting to the database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, tt := range normalizeTests {
+		var want string
+		if err = db.QueryRow(`SELECT public.normalize_address($1)`, tt.address).Scan(&want); err != nil {
+			t.Fatalf("normalising %q in the database: %v", tt.address, err)
+		}
+		if got := Normalize(tt.address); got != want {
+			t.Errorf("%q: got %q, the database has %q", tt.address, got, want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package geocode
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+func checkPlace(p Place, at string) error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("%s: name is required", at)
+	}
+	// NaN passes every comparison, so it is ruled out first
+	if math.IsNaN(p.Latitude) || math.IsNaN(p.Longitude) || math.IsInf(p.Latitude, 0) || math.IsInf(p.Longitude, 0) ||
+		p.Latitude < -90 || p.Latitude > 90 || p.Longitude < -180 || p.Longitude > 180 {
+		return fmt.Errorf("%s: coordinates out of range", at)
+	}
+	return nil
+}
+
+// The gazetteer keeps one place per normalised name, so a file naming one
+// twice would silently keep only the last
+func checkDuplicate(seen map[string]string, p Place, at string) error {
+	name := Normalize(p.Name)
+	if first, ok := seen[name]; ok {
+		return fmt.Errorf("%s: %q is the same place as %s", at, p.Name, first)
+	}
+	seen[name] = at
+	return nil
+}
+
+// Reads a CSV whose header names the columns: name, latitude and longitude
+// (or lat and lng/lon), and optionally address. Other columns are ignored.
+func ParseCSV(r io.Reader) ([]Place, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("the CSV has no header")
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "name":
+			columns["name"] = i
+		case "address":
+			columns["address"] = i
+		case "latitude", "lat":
+			columns["lat"] = i
+		case "longitude", "lng", "lon":
+			columns["lng"] = i
+		}
+	}
+	for _, required := range []string{"name", "lat", "lng"} {
+		if _, ok := columns[required]; !ok {
+			return nil, errors.New("the CSV header needs name, latitude and longitude columns")
+		}
+	}
+
+	places := []Place{}
+	seen := map[string]string{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		at := fmt.Sprintf("line %d", line)
+		var p Place
+		p.Name = strings.TrimSpace(record[columns["name"]])
+		if i, ok := columns["address"]; ok {
+			p.Address = strings.TrimSpace(record[i])
+		}
+		p.Latitude, err = strconv.ParseFloat(strings.TrimSpace(record[columns["lat"]]), 64)
+		if err == nil {
+			p.Longitude, err = strconv.ParseFloat(strings.TrimSpace(record[columns["lng"]]), 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: latitude and longitude must be numbers", at)
+		}
+		if err = checkPlace(p, at); err == nil {
+			err = checkDuplicate(seen, p, at)
+		}
+		if err != nil {
+			return nil, err
+		}
+		places = append(places, p)
+	}
+
+	return places, nil
+}
+
+type geoJSONFile struct {
+	Type     string `json:"type"`
+	Features []struct {
+		Geometry struct {
+			Type        string    `json:"type"`
+			Coordinates []float64 `json:"coordinates"`
+		} `json:"geometry"`
+		Properties struct {
+			Name    string `json:"name"`
+			Address string `json:"address"`
+		} `json:"properties"`
+	} `json:"features"`
+}
+
+// Reads a GeoJSON FeatureCollection of points, named by the name property
+// and optionally addressed by the address property
+func ParseGeoJSON(r io.Reader) ([]Place, error) {
+	var file geoJSONFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, errors.New("the GeoJSON could not be read")
+	}
+	if file.Type != "FeatureCollection" {
+		return nil, errors.New("the GeoJSON must be a FeatureCollection")
+	}
+
+	places := []Place{}
+	seen := map[string]string{}
+	for i, feature := range file.Features {
+		at := fmt.Sprintf("feature %d", i)
+		if feature.Geometry.Type != "Point" || len(feature.Geometry.Coordinates) < 2 {
+			return nil, fmt.Errorf("%s: only points can be imported", at)
+		}
+
+		// GeoJSON puts the longitude first
+		p := Place{
+			Name:      strings.TrimSpace(feature.Properties.Name),
+			Address:   strings.TrimSpace(feature.Properties.Address),
+			Latitude:  feature.Geometry.Coordinates[1],
+			Longitude: feature.Geometry.Coordinates[0],
+		}
+		err := checkPlace(p, at)
+		if err == nil {
+			err = checkDuplicate(seen, p, at)
+		}
+		if err != nil {
+			return nil, err
+		}
+		places = append(places, p)
+	}
+
+	return places, nil
+}
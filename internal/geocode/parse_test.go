@@ -0,0 +1,99 @@
+package geocode
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []Place
+		wantErr string
+	}{
+		{
+			name: "full header",
+			csv:  "name,address,latitude,longitude\nLibrary, 12800 Pegasus Dr ,28.6,-81.2\n",
+			want: []Place{{Name: "Library", Address: "12800 Pegasus Dr", Latitude: 28.6, Longitude: -81.2}},
+		},
+		{
+			name: "short header and extra columns",
+			csv:  "Lon,Name,Lat,Notes\n-81.2,Arena,28.6,big\n",
+			want: []Place{{Name: "Arena", Latitude: 28.6, Longitude: -81.2}},
+		},
+		{name: "empty file", csv: "name,lat,lng\n", want: []Place{}},
+		{name: "no header", csv: "", wantErr: "no header"},
+		{name: "missing column", csv: "name,lat\nLibrary,28.6\n", wantErr: "needs name"},
+		{name: "text coordinate", csv: "name,lat,lng\nLibrary,north,-81.2\n", wantErr: "line 2"},
+		{name: "no name", csv: "name,lat,lng\n ,28.6,-81.2\n", wantErr: "name is required"},
+		{name: "out of range", csv: "name,lat,lng\nLibrary,91,-81.2\n", wantErr: "out of range"},
+		{name: "NaN", csv: "name,lat,lng\nLibrary,NaN,-81.2\n", wantErr: "out of range"},
+		{name: "infinite", csv: "name,lat,lng\nLibrary,28.6,+Inf\n", wantErr: "out of range"},
+		{name: "same name twice", csv: "name,lat,lng\nBldg 1,28.6,-81.2\nBUILDING 1.,28.7,-81.2\n", wantErr: "same place as line 2"},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseCSV(strings.NewReader(tt.csv))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error %v, want one mentioning %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, %v, want %+v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseGeoJSON(t *testing.T) {
+	point := func(name string, lng string, lat string) string {
+		return `{"type": "Feature", "geometry": {"type": "Point", "coordinates": [` + lng + `, ` + lat + `]},
+			"properties": {"name": "` + name + `", "address": " 4000 Central Florida Blvd "}}`
+	}
+	collection := func(features ...string) string {
+		return `{"type": "FeatureCollection", "features": [` + strings.Join(features, ",") + `]}`
+	}
+
+	tests := []struct {
+		name    string
+		json    string
+		want    []Place
+		wantErr string
+	}{
+		{
+			name: "points",
+			json: collection(point("Library", "-81.2", "28.6"), point("Arena", "-81.19", "28.61")),
+			want: []Place{
+				{Name: "Library", Address: "4000 Central Florida Blvd", Latitude: 28.6, Longitude: -81.2},
+				{Name: "Arena", Address: "4000 Central Florida Blvd", Latitude: 28.61, Longitude: -81.19},
+			},
+		},
+		{name: "empty", json: collection(), want: []Place{}},
+		{name: "not JSON", json: "name,lat,lng", wantErr: "could not be read"},
+		{name: "single feature", json: point("Library", "-81.2", "28.6"), wantErr: "FeatureCollection"},
+		{
+			name:    "polygon",
+			json:    collection(`{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": []}, "properties": {"name": "Lawn"}}`),
+			wantErr: "feature 0: only points",
+		},
+		{name: "swapped coordinates", json: collection(point("Library", "28.6", "-181.2")), wantErr: "out of range"},
+		{name: "no name", json: collection(point("", "-81.2", "28.6")), wantErr: "name is required"},
+		{name: "same name twice", json: collection(point("Rec Ctr", "-81.2", "28.6"), point("rec center", "-81.2", "28.6")), wantErr: "feature 1"},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseGeoJSON(strings.NewReader(tt.json))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error %v, want one mentioning %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, %v, want %+v", tt.name, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/render"
+)
+
+// Keeps a long range with a short interval from producing huge series
+const maxAnalyticsBuckets = 400
+
+type AnalyticsPoint struct {
+	PeriodStart time.Time `json:"period_start"`
+	// Current members who had joined by the end of the period. Members who
+	// left are not counted, no history of them is kept.
+	Members    int `json:"members"`
+	NewMembers int `json:"new_members"`
+	Events     int `json:"events"`
+}
+
+type EventEngagement struct {
+	EventId   int             `json:"event_id"`
+	Name      string          `json:"event_name"`
+	StartTime time.Time       `json:"start_time"`
+	Status    string          `json:"status"`
+	RSVPs     int             `json:"rsvps"`
+	Attended  int             `json:"attended"`
+	AvgRating sql.NullFloat64 `json:"avg_rating"`
+	Ratings   int             `json:"ratings"`
+	Comments  int             `json:"comments"`
+}
+
+type AnalyticsTotals struct {
+	Members   int     `json:"members"`
+	Events    int     `json:"events"`
+	RSVPs     int     `json:"rsvps"`
+	Attended  int     `json:"attended"`
+	Turnout   float64 `json:"turnout"`
+	AvgRating float64 `json:"avg_rating"`
+	Comments  int     `json:"comments"`
+}
+
+// Events the RSO runs or co-hosts, for the aggregates below. $1 is the RSO.
+const rsoHostedEvents = `(e.rso_id = $1 OR EXISTS (SELECT 1 FROM public."Event_Hosts" h
+		WHERE h.event_id = e.event_id AND h.rso_id = $1 AND h.status = 'accepted'))`
+
+// Reads ?from=, ?to= (YYYY-MM-DD or RFC 3339) and ?interval= (week or month,
+// the default). The range defaults to the last 12 months.
+func parseAnalyticsRange(r *http.Request) (from time.Time, to time.Time, interval string, err error) {
+	params := r.URL.Query()
+
+	parse := func(value string, fallback time.Time) (time.Time, error) {
+		if value == "" {
+			return fallback, nil
+		}
+		if t, err := time.Parse("2006-01-02", value); err == nil {
+			return t, nil
+		}
+		return time.Parse(time.RFC3339, value)
+	}
+
+	to, err = parse(params.Get("to"), time.Now())
+	if err != nil {
+		return from, to, "", errors.New("to must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+	}
+	from, err = parse(params.Get("from"), to.AddDate(-1, 0, 0))
+	if err != nil {
+		return from, to, "", errors.New("from must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+	}
+	if !from.Before(to) {
+		return from, to, "", errors.New("from must be before to")
+	}
+
+	interval = params.Get("interval")
+	if interval == "" {
+		interval = "month"
+	}
+
+	var step time.Duration
+	switch interval {
+	case "week":
+		step = 7 * 24 * time.Hour
+	case "month":
+		step = 28 * 24 * time.Hour
+	default:
+		return from, to, "", errors.New("interval must be week or month")
+	}
+
+	if to.Sub(from)/step > maxAnalyticsBuckets {
+		return from, to, "", fmt.Errorf("the range is too long for a %s interval", interval)
+	}
+
+	return from, to, interval, nil
+}
+
+func queryGrowth(db *sql.DB, rsoId int, from time.Time, to time.Time, interval string) ([]AnalyticsPoint, error) {
+	query := `WITH buckets AS (
+				SELECT b AS period_start, b + ('1 ' || $2)::interval AS period_end
+				FROM generate_series(date_trunc($2, $3::timestamptz), $4::timestamptz, ('1 ' || $2)::interval) b
+			)
+			SELECT b.period_start,
+			(SELECT COUNT(*) FROM public."User_RSO_Membership" m WHERE m.rso_id = $1 AND m.date_joined < b.period_end),
+			(SELECT COUNT(*) FROM public."User_RSO_Membership" m WHERE m.rso_id = $1
+				AND m.date_joined >= b.period_start AND m.date_joined < b.period_end),
+			(SELECT COUNT(*) FROM public."Events" e WHERE ` + rsoHostedEvents + ` AND e.status <> 'cancelled'
+				AND e.start_time >= b.period_start AND e.start_time < b.period_end)
+			FROM buckets b
+			ORDER BY b.period_start`
+
+	rows, err := db.Query(query, rsoId, interval, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var series []AnalyticsPoint
+	for rows.Next() {
+		var point AnalyticsPoint
+		if err = rows.Scan(&point.PeriodStart, &point.Members, &point.NewMembers, &point.Events); err != nil {
+			return nil, err
+		}
+		series = append(series, point)
+	}
+
+	return series, rows.Err()
+}
+
+func queryEngagement(db *sql.DB, rsoId int, from time.Time, to time.Time) ([]EventEngagement, error) {
+	query := `SELECT e.event_id, e.name, e.start_time, e.status,
+			(SELECT COUNT(*) FROM public.user_event_membership uem WHERE uem.event_id = e.event_id),
+			(SELECT COUNT(*) FROM public.user_event_membership uem WHERE uem.event_id = e.event_id AND uem.checked_in_at IS NOT NULL),
+			(SELECT AVG(f.rating)::float8 FROM public."Event_Feedback" f WHERE f.event_id = e.event_id AND f.feedback_type = 'rating'),
+			(SELECT COUNT(*) FROM public."Event_Feedback" f WHERE f.event_id = e.event_id AND f.feedback_type = 'rating'),
+			(SELECT COUNT(*) FROM public."Event_Feedback" f WHERE f.event_id = e.event_id AND f.feedback_type = 'comment')
+			FROM public."Events" e
+			WHERE ` + rsoHostedEvents + ` AND e.start_time >= $2 AND e.start_time < $3
+			ORDER BY e.start_time`
+
+	rows, err := db.Query(query, rsoId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []EventEngagement
+	for rows.Next() {
+		var event EventEngagement
+		err = rows.Scan(&event.EventId, &event.Name, &event.StartTime, &event.Status, &event.RSVPs, &event.Attended,
+			&event.AvgRating, &event.Ratings, &event.Comments)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func analyticsTotals(series []AnalyticsPoint, events []EventEngagement) AnalyticsTotals {
+	var totals AnalyticsTotals
+	if len(series) > 0 {
+		totals.Members = series[len(series)-1].Members
+	}
+
+	ratingSum, ratings := 0.0, 0
+	for _, event := range events {
+		if event.Status == "cancelled" {
+			continue
+		}
+		totals.Events++
+		totals.RSVPs += event.RSVPs
+		totals.Attended += event.Attended
+		totals.Comments += event.Comments
+		if event.AvgRating.Valid {
+			ratingSum += event.AvgRating.Float64 * float64(event.Ratings)
+			ratings += event.Ratings
+		}
+	}
+
+	if totals.RSVPs > 0 {
+		totals.Turnout = float64(totals.Attended) / float64(totals.RSVPs)
+	}
+	if ratings > 0 {
+		totals.AvgRating = ratingSum / float64(ratings)
+	}
+
+	return totals
+}
+
+// Auth token required...
+// Engagement of the RSO for its officers. ?format=csv with ?report=growth
+// (default) or events downloads one of the two tables.
+func GetRSOAnalytics(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, ok := checkRSOOfficer(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	from, to, interval, err := parseAnalyticsRange(r)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	series, err := queryGrowth(db, rsoId, from, to, interval)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Error getting member growth: " + err.Error(),
+		})
+		return
+	}
+
+	events, err := queryEngagement(db, rsoId, from, to)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Error getting event engagement: " + err.Error(),
+		})
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		writeAnalyticsCSV(w, r, rsoId, series, events)
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data": map[string]interface{}{
+			"from":     from,
+			"to":       to,
+			"interval": interval,
+			"growth":   series,
+			"events":   events,
+			"totals":   analyticsTotals(series, events),
+		},
+	})
+}
+
+func writeAnalyticsCSV(w http.ResponseWriter, r *http.Request, rsoId int, series []AnalyticsPoint, events []EventEngagement) {
+	report := r.URL.Query().Get("report")
+	if report == "" {
+		report = "growth"
+	}
+	if report != "growth" && report != "events" {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "report must be growth or events",
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("rso-%d-%s.csv", rsoId, report)
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	out := csv.NewWriter(w)
+	if report == "growth" {
+		_ = out.Write([]string{"period_start", "members", "new_members", "events"})
+		for _, point := range series {
+			_ = out.Write([]string{point.PeriodStart.Format("2006-01-02"), strconv.Itoa(point.Members),
+				strconv.Itoa(point.NewMembers), strconv.Itoa(point.Events)})
+		}
+	} else {
+		_ = out.Write([]string{"event_id", "event_name", "start_time", "status", "rsvps", "attended", "avg_rating", "ratings", "comments"})
+		for _, event := range events {
+			rating := ""
+			if event.AvgRating.Valid {
+				rating = strconv.FormatFloat(event.AvgRating.Float64, 'f', 2, 64)
+			}
+			_ = out.Write([]string{strconv.Itoa(event.EventId), csvCell(event.Name), event.StartTime.Format(time.RFC3339),
+				csvCell(event.Status), strconv.Itoa(event.RSVPs), strconv.Itoa(event.Attended), rating,
+				strconv.Itoa(event.Ratings), strconv.Itoa(event.Comments)})
+		}
+	}
+	out.Flush()
+}
@@ -0,0 +1,561 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/bingKegeta/Knight-Link/internal/notify"
+)
+
+const maxAnnouncementLength = 10000
+
+type AnnouncementForm struct {
+	Title string `json:"title"`
+	// Markdown
+	Body   string `json:"body"`
+	Pinned bool   `json:"pinned"`
+	// RFC 3339, empty for announcements that never expire
+	ExpiresAt string `json:"expires_at"`
+}
+
+// Fields left out are not changed, an empty expires_at removes the expiry
+type AnnouncementUpdateForm struct {
+	Title     *string `json:"title"`
+	Body      *string `json:"body"`
+	Pinned    *bool   `json:"pinned"`
+	ExpiresAt *string `json:"expires_at"`
+}
+
+type Announcement struct {
+	AnnouncementId int            `json:"announcement_id"`
+	RsoId          int            `json:"rso_id"`
+	RsoName        string         `json:"rso_name"`
+	Author         sql.NullString `json:"author"`
+	Title          string         `json:"title"`
+	Body           string         `json:"body"`
+	Pinned         bool           `json:"pinned"`
+	ExpiresAt      sql.NullString `json:"expires_at"`
+	DatePosted     string         `json:"date_posted"`
+	DateEdited     sql.NullString `json:"date_edited"`
+	Read           bool           `json:"read"`
+}
+
+func validateAnnouncement(title string, body string) error {
+	if strings.TrimSpace(title) == "" || strings.TrimSpace(body) == "" {
+		return errors.New("an announcement needs a title and a body")
+	}
+	if utf8.RuneCountInString(title) > 255 {
+		return errors.New("the title can be at most 255 characters")
+	}
+	if utf8.RuneCountInString(body) > maxAnnouncementLength {
+		return errors.New("the body is too long")
+	}
+	return nil
+}
+
+// Empty means no expiry
+func parseExpiry(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	expires, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, errors.New("expires_at must be an RFC 3339 timestamp")
+	}
+	if !expires.After(time.Now()) {
+		return nil, errors.New("expires_at must be in the future")
+	}
+
+	return &expires, nil
+}
+
+// Announcements as the user sees them. $1 is always the user id.
+func queryAnnouncements(db *sql.DB, where string, args ...interface{}) ([]Announcement, error) {
+	query := `SELECT a.announcement_id, a.rso_id, r.name, u.username, a.title, a.body, a.pinned, a.expires_at,
+			a.date_posted, a.date_edited,
+			EXISTS (SELECT 1 FROM public."Announcement_Reads" ar WHERE ar.announcement_id = a.announcement_id AND ar.user_id = $1)
+			FROM public."RSO_Announcements" a
+			JOIN public."RSOs" r ON r.rso_id = a.rso_id
+			LEFT JOIN public."Users" u ON u.user_id = a.author_id
+			WHERE (a.expires_at IS NULL OR a.expires_at > CURRENT_TIMESTAMP) AND ` + where + `
+			ORDER BY a.pinned DESC, a.date_posted DESC`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var announcements []Announcement
+	for rows.Next() {
+		var a Announcement
+		err = rows.Scan(&a.AnnouncementId, &a.RsoId, &a.RsoName, &a.Author, &a.Title, &a.Body, &a.Pinned,
+			&a.ExpiresAt, &a.DatePosted, &a.DateEdited, &a.Read)
+		if err != nil {
+			return nil, err
+		}
+		announcements = append(announcements, a)
+	}
+
+	return announcements, rows.Err()
+}
+
+// Sends the announcement to every member but the author
+func notifyMembers(r *http.Request, db *sql.DB, rsoId int, authorId int, subject string, body string) {
+	query := `SELECT u.email FROM public."User_RSO_Membership" m
+			JOIN public."Users" u ON u.user_id = m.user_id
+			WHERE m.rso_id = $1 AND m.user_id <> $2 AND u.email IS NOT NULL AND u.email <> ''`
+
+	rows, err := db.Query(query, rsoId, authorId)
+	if err != nil {
+		log.Printf("Error getting members of RSO %d: %v", rsoId, err)
+		return
+	}
+	defer rows.Close()
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err = rows.Scan(&email); err != nil {
+			log.Printf("Error scanning member of RSO %d: %v", rsoId, err)
+			return
+		}
+		emails = append(emails, email)
+	}
+
+	for _, email := range emails {
+		err = notifier.Notify(r.Context(), notify.Message{To: email, Subject: subject, Body: body})
+		if err != nil {
+			log.Printf("Error notifying %s about an announcement of RSO %d: %v", email, rsoId, err)
+		}
+	}
+}
+
+// Auth token required...
+// Officers post an announcement to the members of the RSO
+func CreateAnnouncement(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, ok := checkRSOOfficer(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	var form AnnouncementForm
+	err = json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "There was an error parsing the data",
+		})
+		return
+	}
+
+	expires, err := parseExpiry(form.ExpiresAt)
+	if err == nil {
+		err = validateAnnouncement(form.Title, form.Body)
+	}
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var rsoName string
+	err = db.QueryRow(`SELECT name FROM public."RSOs" WHERE rso_id = $1 AND archived_at IS NULL`, rsoId).Scan(&rsoName)
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "RSO not found",
+		})
+		return
+	}
+
+	var announcementId int
+	query := `INSERT INTO public."RSO_Announcements" (rso_id, author_id, title, body, pinned, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING announcement_id`
+	err = db.QueryRow(query, rsoId, user.UserID, strings.TrimSpace(form.Title), form.Body, form.Pinned, expires).
+		Scan(&announcementId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	// The author has read their own announcement
+	_, _ = db.Exec(`INSERT INTO public."Announcement_Reads" (announcement_id, user_id) VALUES ($1, $2)`,
+		announcementId, user.UserID)
+
+	notifyMembers(r, db, rsoId, user.UserID, rsoName+": "+strings.TrimSpace(form.Title), form.Body)
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, map[string]interface{}{
+		"status":          "success",
+		"message":         "Announcement posted",
+		"announcement_id": announcementId,
+	})
+}
+
+// Auth token required...
+// Members see the current announcements of their RSO
+func GetRSOAnnouncements(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, err := strconv.Atoi(chi.URLParam(r, "rsoId"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid RSO ID",
+		})
+		return
+	}
+
+	role, err := rsoRole(db, user.UserID, rsoId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	superadmin, err := isSuperadminOfRSO(db, user, rsoId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if role == "" && !superadmin {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Only members of the RSO can see its announcements",
+		})
+		return
+	}
+
+	announcements, err := queryAnnouncements(db, `a.rso_id = $2`, user.UserID, rsoId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting announcements",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data":   announcements,
+	})
+}
+
+// Auth token required...
+// The announcements of every RSO the user belongs to, ?unread=true for the
+// unread ones only
+func GetAnnouncementFeed(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	where := `a.rso_id IN (SELECT rso_id FROM public."User_RSO_Membership" WHERE user_id = $1)`
+	if r.URL.Query().Get("unread") == "true" {
+		where += ` AND NOT EXISTS (SELECT 1 FROM public."Announcement_Reads" ar
+				WHERE ar.announcement_id = a.announcement_id AND ar.user_id = $1)`
+	}
+
+	announcements, err := queryAnnouncements(db, where, user.UserID)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting announcements",
+		})
+		return
+	}
+
+	unread := 0
+	for _, a := range announcements {
+		if !a.Read {
+			unread++
+		}
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data":   announcements,
+		"unread": unread,
+	})
+}
+
+// Auth token required...
+func UpdateAnnouncement(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, ok := checkRSOOfficer(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	var form AnnouncementUpdateForm
+	err = json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "There was an error parsing the data",
+		})
+		return
+	}
+
+	// Check the new values against the current ones
+	var title, body string
+	query := `SELECT title, body FROM public."RSO_Announcements" WHERE announcement_id = $1 AND rso_id = $2`
+	err = db.QueryRow(query, chi.URLParam(r, "announcementId"), rsoId).Scan(&title, &body)
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Announcement not found",
+		})
+		return
+	}
+
+	if form.Title != nil {
+		title = strings.TrimSpace(*form.Title)
+	}
+	if form.Body != nil {
+		body = *form.Body
+	}
+
+	var expires *time.Time
+	err = validateAnnouncement(title, body)
+	if err == nil && form.ExpiresAt != nil {
+		expires, err = parseExpiry(*form.ExpiresAt)
+	}
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	query = `UPDATE public."RSO_Announcements" SET title = $1, body = $2, pinned = COALESCE($3, pinned),
+			expires_at = CASE WHEN $4 THEN $5 ELSE expires_at END, date_edited = CURRENT_TIMESTAMP
+			WHERE announcement_id = $6 AND rso_id = $7`
+	_, err = db.Exec(query, title, body, form.Pinned, form.ExpiresAt != nil, expires,
+		chi.URLParam(r, "announcementId"), rsoId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "Announcement updated",
+	})
+}
+
+// Auth token required...
+func DeleteAnnouncement(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, ok := checkRSOOfficer(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	result, err := db.Exec(`DELETE FROM public."RSO_Announcements" WHERE announcement_id = $1 AND rso_id = $2`,
+		chi.URLParam(r, "announcementId"), rsoId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Announcement not found",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "Announcement deleted",
+	})
+}
+
+// Auth token required...
+// PUT marks the announcement read, DELETE marks it unread again
+func MarkAnnouncementRead(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	announcementId := chi.URLParam(r, "announcementId")
+
+	// Only members can read the announcements of an RSO
+	var member bool
+	query := `SELECT EXISTS(SELECT 1 FROM public."RSO_Announcements" a
+			JOIN public."User_RSO_Membership" m ON m.rso_id = a.rso_id
+			WHERE a.announcement_id = $1 AND m.user_id = $2)`
+	err = db.QueryRow(query, announcementId, user.UserID).Scan(&member)
+	if err != nil || !member {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Announcement not found",
+		})
+		return
+	}
+
+	read := r.Method != http.MethodDelete
+	if read {
+		query = `INSERT INTO public."Announcement_Reads" (announcement_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	} else {
+		query = `DELETE FROM public."Announcement_Reads" WHERE announcement_id = $1 AND user_id = $2`
+	}
+
+	if _, err = db.Exec(query, announcementId, user.UserID); err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"read":   read,
+	})
+}
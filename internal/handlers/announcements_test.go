@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+
+	"github.com/bingKegeta/Knight-Link/internal/notify"
+)
+
+// Members are mailed before the request returns, and only members can read
+// the announcements of the RSO
+func TestAnnouncementsOnlyForMembers(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+	admin := f.addUser(t, db, "admin", f.uniId, "student")
+	outsider := f.addUser(t, db, "outsider", f.uniId, "student")
+	rsoId := f.addRSO(t, db, "announcing", f.uniId, admin)
+
+	_, err := db.Exec(`INSERT INTO public."User_RSO_Membership" (user_id, rso_id, role) VALUES ($1, $2, 'member')`, f.student.UserID, rsoId)
+	if err == nil {
+		_, err = db.Exec(`UPDATE public."Users" SET email = $1 WHERE user_id = $2`, "member"+f.suffix+"@example.com", f.student.UserID)
+	}
+	if err != nil {
+		t.Fatalf("adding the member: %v", err)
+	}
+
+	recorder := &recordingNotifier{}
+	SetNotifier(recorder)
+	t.Cleanup(func() { SetNotifier(notify.LogNotifier{}) })
+
+	router := chi.NewRouter()
+	router.Get("/{rsoId}/announcements", GetRSOAnnouncements)
+	router.Post("/{rsoId}/announcements", CreateAnnouncement)
+	target := fmt.Sprintf("/%d/announcements", rsoId)
+
+	body := strings.NewReader(`{"title": "Meeting", "body": "Tonight at eight"}`)
+	r := asUser(t, httptest.NewRequest(http.MethodPost, target, body), admin.UserName)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("posting: status %d: %s", w.Code, w.Body.String())
+	}
+	if len(recorder.messages) != 1 || recorder.messages[0].To != "member"+f.suffix+"@example.com" {
+		t.Errorf("sent %+v, want the announcement to the member", recorder.messages)
+	}
+
+	tests := []struct {
+		user SessionUser
+		code int
+	}{
+		{f.student, http.StatusOK},
+		{outsider, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r = asUser(t, httptest.NewRequest(http.MethodGet, target, nil), tt.user.UserName)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%s: status %d, want %d", tt.user.UserName, w.Code, tt.code)
+		}
+	}
+}
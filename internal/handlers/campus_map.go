@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+const (
+	// Events of the next month unless ?to= says otherwise
+	defaultMapWindow = 30 * 24 * time.Hour
+	maxMapWindow     = 366 * 24 * time.Hour
+)
+
+// GeoJSON (RFC 7946) types, only as much as the map needs
+type GeoFeatureCollection struct {
+	Type     string       `json:"type"`
+	Features []GeoFeature `json:"features"`
+}
+
+type GeoFeature struct {
+	Type       string        `json:"type"`
+	Geometry   GeoPoint      `json:"geometry"`
+	Properties MapProperties `json:"properties"`
+}
+
+// Coordinates are longitude first, as GeoJSON wants
+type GeoPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+type MapProperties struct {
+	LocId   int        `json:"loc_id"`
+	Address string     `json:"address"`
+	Events  []MapEvent `json:"events"`
+}
+
+type MapEvent struct {
+	EventId        int           `json:"event_id"`
+	Name           string        `json:"name"`
+	Visibility     string        `json:"visibility"`
+	Status         string        `json:"status"`
+	AttendanceMode string        `json:"attendance_mode"`
+	RsoId          sql.NullInt32 `json:"rso_id"`
+	EventTimes
+}
+
+// Reads ?from= and ?to= as dates (YYYY-MM-DD) or RFC 3339 timestamps
+func parseMapWindow(r *http.Request) (time.Time, time.Time, error) {
+	params := r.URL.Query()
+
+	parse := func(value string, fallback time.Time) (time.Time, error) {
+		if value == "" {
+			return fallback, nil
+		}
+		if t, err := time.Parse("2006-01-02", value); err == nil {
+			return t, nil
+		}
+		return time.Parse(time.RFC3339, value)
+	}
+
+	from, err := parse(params.Get("from"), time.Now())
+	if err != nil {
+		return from, from, errors.New("from must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+	}
+	to, err := parse(params.Get("to"), from.Add(defaultMapWindow))
+	if err != nil {
+		return from, to, errors.New("to must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+	}
+	if !from.Before(to) {
+		return from, to, errors.New("from must be before to")
+	}
+	if to.Sub(from) > maxMapWindow {
+		return from, to, errors.New("the time window can be at most a year")
+	}
+
+	return from, to, nil
+}
+
+// Auth token required...
+// GeoJSON of the places the university's events use, each with the upcoming
+// events the user may see between ?from= and ?to=. Places without
+// coordinates are left out, and so are online events, which have no place.
+func GetUniMap(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	from, to, err := parseMapWindow(r)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var uniId int
+	err = db.QueryRow(`SELECT uni_id FROM public."Universities" WHERE uni_id = $1 AND archived_at IS NULL`,
+		chi.URLParam(r, "uni_id")).Scan(&uniId)
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "University not found",
+		})
+		return
+	}
+
+	tx, err := BeginUserTx(db, user)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	query := `SELECT l.loc_id, COALESCE(l.address, ''), l.latitude, l.longitude,
+			e.event_id, e.name, e.start_time, e.end_time, e.time_zone, e.visibility, e.status, e.attendance_mode, e.rso_id
+			FROM public."Locations" l
+			LEFT JOIN public."Events" e ON e.loc_id = l.loc_id AND e.uni_id = $2
+				AND e.end_time > $3 AND e.start_time < $4 AND e.status IN ('scheduled', 'postponed')
+				AND ` + visibleEventClause + `
+			WHERE l.loc_id IN (SELECT loc_id FROM public."Events" WHERE uni_id = $2)
+			ORDER BY l.loc_id, e.start_time`
+
+	rows, err := tx.Query(query, user.UserID, uniId, from, to)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting the map",
+		})
+		return
+	}
+	defer rows.Close()
+
+	collection := GeoFeatureCollection{Type: "FeatureCollection", Features: []GeoFeature{}}
+	var feature *GeoFeature
+	for rows.Next() {
+		var locId int
+		var address string
+		var latitude, longitude sql.NullFloat64
+		var eventId sql.NullInt32
+		var name, zone, visibility, status, mode sql.NullString
+		var start, end sql.NullTime
+		var rsoId sql.NullInt32
+		err = rows.Scan(&locId, &address, &latitude, &longitude, &eventId, &name, &start, &end, &zone,
+			&visibility, &status, &mode, &rsoId)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Error getting the map",
+			})
+			return
+		}
+
+		if feature == nil || feature.Properties.LocId != locId {
+			if !latitude.Valid || !longitude.Valid {
+				feature = nil
+				continue
+			}
+
+			collection.Features = append(collection.Features, GeoFeature{
+				Type:     "Feature",
+				Geometry: GeoPoint{Type: "Point", Coordinates: [2]float64{longitude.Float64, latitude.Float64}},
+				Properties: MapProperties{
+					LocId:   locId,
+					Address: address,
+					Events:  []MapEvent{},
+				},
+			})
+			feature = &collection.Features[len(collection.Features)-1]
+		}
+
+		if eventId.Valid {
+			feature.Properties.Events = append(feature.Properties.Events, MapEvent{
+				EventId:        int(eventId.Int32),
+				Name:           name.String,
+				Visibility:     visibility.String,
+				Status:         status.String,
+				AttendanceMode: mode.String,
+				RsoId:          rsoId,
+				EventTimes:     newEventTimes(start.Time, end.Time, zone.String),
+			})
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error iterating over rows",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	json.NewEncoder(w).Encode(collection)
+}
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+type CoHostInvite struct {
+	RsoName string `json:"rso_name"`
+}
+
+type CoHostResponse struct {
+	Accept bool `json:"accept"`
+}
+
+type PendingCoHost struct {
+	EventId   int    `json:"event_id"`
+	EventName string `json:"event_name"`
+	RsoId     int    `json:"rso_id"`
+	RsoName   string `json:"rso_name"`
+	InvitedBy string `json:"invited_by"`
+}
+
+// Hosts of an event, the primary RSO included. Pending and declined
+// invitations are left out unless acceptedOnly is false.
+func getEventHosts(db querier, eventId int, acceptedOnly bool) ([]EventHost, error) {
+	query := `SELECT h.rso_id, r.name, h.status FROM public."Event_Hosts" h
+			JOIN public."RSOs" r ON r.rso_id = h.rso_id
+			WHERE h.event_id = $1 AND (NOT $2 OR h.status = 'accepted')
+			ORDER BY h.date_invited`
+
+	rows, err := db.Query(query, eventId, acceptedOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hosts := []EventHost{}
+	for rows.Next() {
+		var host EventHost
+		err = rows.Scan(&host.RsoId, &host.RsoName, &host.Status)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, host)
+	}
+
+	return hosts, rows.Err()
+}
+
+// Whether the user administers one of the accepted host RSOs of the event
+func isEventHostAdmin(db *sql.DB, userId int, eventId int) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM public."Event_Hosts" h
+			JOIN public."RSOs" r ON r.rso_id = h.rso_id
+			WHERE h.event_id = $1 AND h.status = 'accepted' AND r.admin_id = $2)`
+	err := db.QueryRow(query, eventId, userId).Scan(&exists)
+
+	return exists, err
+}
+
+// Auth token required...
+// An admin of a host RSO invites another RSO to co-host the event
+func InviteCoHost(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	eventId, err := strconv.Atoi(chi.URLParam(r, "eventId"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid event ID",
+		})
+		return
+	}
+
+	var invite CoHostInvite
+	err = json.NewDecoder(r.Body).Decode(&invite)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "There was an error parsing the data",
+		})
+		return
+	}
+
+	allowed, err := isEventHostAdmin(db, user.UserID, eventId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if !allowed {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Only admins of a hosting RSO can invite co-hosts",
+		})
+		return
+	}
+
+	// Only RSOs of the event's own university can co-host it
+	var rsoId int
+	query := `SELECT r.rso_id FROM public."RSOs" r
+			JOIN public."Events" e ON e.uni_id = r.uni_id
+			WHERE r.name = $1 AND e.event_id = $2 AND r.archived_at IS NULL`
+	err = db.QueryRow(query, invite.RsoName, eventId).Scan(&rsoId)
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "There was an error getting the RSO ID",
+		})
+		return
+	}
+
+	// A declined invitation can be sent again, anything else is already settled
+	query = `INSERT INTO public."Event_Hosts" (event_id, rso_id, status, invited_by)
+			VALUES ($1, $2, 'pending', $3)
+			ON CONFLICT (event_id, rso_id) DO UPDATE
+			SET status = 'pending', invited_by = EXCLUDED.invited_by, date_invited = CURRENT_TIMESTAMP
+			WHERE "Event_Hosts".status = 'declined'`
+
+	result, err := db.Exec(query, eventId, rsoId, user.UserID)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error inviting the RSO: " + err.Error(),
+		})
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "This RSO is already hosting or invited to the event",
+		})
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "Co-host invitation sent",
+	})
+}
+
+// Auth token required...
+// The admin of an invited RSO accepts or declines the invitation
+func RespondCoHost(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	eventId, err := strconv.Atoi(chi.URLParam(r, "eventId"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid event ID",
+		})
+		return
+	}
+
+	rsoId, err := strconv.Atoi(chi.URLParam(r, "rsoId"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid RSO ID",
+		})
+		return
+	}
+
+	var response CoHostResponse
+	err = json.NewDecoder(r.Body).Decode(&response)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "There was an error parsing the data",
+		})
+		return
+	}
+
+	admin, err := isRSOAdmin(db, user.UserID, rsoId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if !admin {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Only the admin of the invited RSO can respond",
+		})
+		return
+	}
+
+	status := "declined"
+	if response.Accept {
+		status = "accepted"
+	}
+
+	query := `UPDATE public."Event_Hosts" SET status = $1
+			WHERE event_id = $2 AND rso_id = $3 AND status = 'pending'`
+	result, err := db.Exec(query, status, eventId, rsoId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "No pending invitation for this RSO",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "Invitation " + status,
+	})
+}
+
+// Auth token required...
+// Pending co-host invitations for every RSO the user administers
+func GetCoHostInvitations(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	query := `SELECT e.event_id, e.name, r.rso_id, r.name, COALESCE(u.username, '')
+			FROM public."Event_Hosts" h
+			JOIN public."Events" e ON e.event_id = h.event_id
+			JOIN public."RSOs" r ON r.rso_id = h.rso_id
+			LEFT JOIN public."Users" u ON u.user_id = h.invited_by
+			WHERE h.status = 'pending' AND r.admin_id = $1
+			ORDER BY h.date_invited`
+
+	rows, err := db.Query(query, user.UserID)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting invitations",
+		})
+		return
+	}
+	defer rows.Close()
+
+	var invitations []PendingCoHost
+
+	for rows.Next() {
+		var invitation PendingCoHost
+		err = rows.Scan(&invitation.EventId, &invitation.EventName, &invitation.RsoId, &invitation.RsoName, &invitation.InvitedBy)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Error getting invitations array",
+			})
+			return
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	if err = rows.Err(); err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error iterating over rows",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data":   invitations,
+	})
+}
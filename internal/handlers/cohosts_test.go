@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// Only RSOs of the event's university can be invited to co-host it
+func TestInviteCoHostSameUniversity(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+	host := f.addUser(t, db, "host", f.uniId, "student")
+	hostRSO := f.addRSO(t, db, "host", f.uniId, host)
+	f.addRSO(t, db, "neighbour", f.uniId, f.student)
+	otherUni := f.addUni(t, db, "other")
+	f.addRSO(t, db, "elsewhere", otherUni, f.addUser(t, db, "elsewhere", otherUni, "student"))
+
+	eventId := f.addEvent(t, db, "hosted", 4*time.Hour, "public", f.uniId, hostRSO, nil)
+	_, err := db.Exec(`INSERT INTO public."Event_Hosts" (event_id, rso_id, status) VALUES ($1, $2, 'accepted')`, eventId, hostRSO)
+	if err != nil {
+		t.Fatalf("adding the host: %v", err)
+	}
+
+	router := chi.NewRouter()
+	router.Post("/{eventId}/hosts", InviteCoHost)
+	router.Put("/{eventId}/hosts/{rsoId}", RespondCoHost)
+
+	tests := []struct {
+		rso  string
+		code int
+	}{
+		{"elsewhere", http.StatusNotFound},
+		{"neighbour", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		body := strings.NewReader(`{"rso_name": "Test ` + tt.rso + ` ` + f.suffix + `"}`)
+		r := asUser(t, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/%d/hosts", eventId), body), host.UserName)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%s: status %d, want %d: %s", tt.rso, w.Code, tt.code, w.Body.String())
+		}
+	}
+
+	r := asUser(t, httptest.NewRequest(http.MethodPut, fmt.Sprintf("/abc/hosts/%d", hostRSO), strings.NewReader(`{"accept": true}`)), host.UserName)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("non-numeric event: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
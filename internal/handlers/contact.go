@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/bingKegeta/Knight-Link/internal/notify"
+)
+
+const maxContactMessage = 2000
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+type ContactMessage struct {
+	Subject string `json:"subject"`
+	Message string `json:"message"`
+}
+
+type PhoneForm struct {
+	Phone string `json:"phone"`
+}
+
+// Phone numbers are stored in E.164, e.g. +14075551234, at most 16 characters
+func validatePhone(field string, phone string) error {
+	if !e164.MatchString(phone) {
+		return fmt.Errorf("%s must be in E.164 format, e.g. +14075551234", field)
+	}
+	return nil
+}
+
+// Only a bare address is accepted, not "Name <address>"
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return fmt.Errorf("contact_email is not a valid email address")
+	}
+	return nil
+}
+
+// Validates the contact details the client sent and fills in missing ones
+// from the creating user. Stored details that are not valid, e.g. from before
+// they were checked, are left out instead of failing the request.
+func resolveEventContact(db *sql.DB, userId int, event *EventForm) error {
+	// Both stay optional, but whatever the client sends has to be valid
+	if event.ContactPhone != "" {
+		if err := validatePhone("contact_phone", event.ContactPhone); err != nil {
+			return err
+		}
+	}
+	if event.ContactEmail != "" {
+		if err := validateEmail(event.ContactEmail); err != nil {
+			return err
+		}
+	}
+
+	if event.ContactPhone != "" && event.ContactEmail != "" {
+		return nil
+	}
+
+	var phone, email sql.NullString
+	err := db.QueryRow(`SELECT phone, email FROM public."Users" WHERE user_id = $1`, userId).Scan(&phone, &email)
+	if err != nil {
+		return err
+	}
+
+	if event.ContactPhone == "" && phone.String != "" {
+		if err := validatePhone("phone", phone.String); err != nil {
+			log.Printf("Not using the stored phone of user %d as event contact: %v", userId, err)
+		} else {
+			event.ContactPhone = phone.String
+		}
+	}
+	if event.ContactEmail == "" && email.String != "" {
+		if err := validateEmail(email.String); err != nil {
+			log.Printf("Not using the stored email of user %d as event contact: %v", userId, err)
+		} else {
+			event.ContactEmail = email.String
+		}
+	}
+
+	return nil
+}
+
+// Auth token required...
+// Sets the user's own phone number, the default contact of the events they
+// create from then on. An empty phone removes it.
+func UpdatePhone(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	var form PhoneForm
+	err = json.NewDecoder(r.Body).Decode(&form)
+	if err == nil && form.Phone != "" {
+		err = validatePhone("phone", form.Phone)
+	}
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	_, err = db.Exec(`UPDATE public."Users" SET phone = NULLIF($1, '') WHERE user_id = $2`, form.Phone, user.UserID)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "Phone number updated",
+	})
+}
+
+// Organisers and attendees may see the contact details of an event
+func canSeeEventContact(db *sql.DB, userId int, eventId int) (bool, error) {
+	var attending bool
+	query := `SELECT EXISTS(SELECT 1 FROM public."user_event_membership" WHERE user_id = $1 AND event_id = $2)`
+	err := db.QueryRow(query, userId, eventId).Scan(&attending)
+	if err != nil || attending {
+		return attending, err
+	}
+
+	return isEventOrganiser(db, userId, eventId)
+}
+
+// Auth token required...
+// Relays a message to the event's contact email without showing the address
+func ContactOrganiser(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	eventId, err := strconv.Atoi(chi.URLParam(r, "eventId"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid event ID",
+		})
+		return
+	}
+
+	var contact ContactMessage
+	err = json.NewDecoder(r.Body).Decode(&contact)
+	if err == nil && (strings.TrimSpace(contact.Message) == "" || len(contact.Message) > maxContactMessage) {
+		err = errors.New("message must be between 1 and 2000 characters")
+	}
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// Only people who can see the event can reach its organiser
+	var eventName string
+	var contactEmail sql.NullString
+	query := `SELECT e.name, e.contact_email FROM public."Events" e WHERE e.event_id = $2 AND ` + visibleEventClause
+	err = db.QueryRow(query, user.UserID, eventId).Scan(&eventName, &contactEmail)
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Event not found",
+		})
+		return
+	}
+
+	if contactEmail.String == "" {
+		render.Status(r, http.StatusUnprocessableEntity)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "This event has no contact email",
+		})
+		return
+	}
+
+	var senderEmail sql.NullString
+	_ = db.QueryRow(`SELECT email FROM public."Users" WHERE user_id = $1`, user.UserID).Scan(&senderEmail)
+
+	subject := strings.Join(strings.Fields(contact.Subject), " ")
+	if subject == "" {
+		subject = "Question about your event"
+	}
+
+	err = notifier.Notify(r.Context(), notify.Message{
+		To:      contactEmail.String,
+		ReplyTo: senderEmail.String,
+		Subject: "[" + eventName + "] " + subject,
+		Body:    "Message from " + user.UserName + " about " + eventName + ":\n\n" + contact.Message,
+	})
+	if err != nil {
+		render.Status(r, http.StatusBadGateway)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "The message could not be delivered",
+		})
+		return
+	}
+
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "Message sent to the organiser",
+	})
+}
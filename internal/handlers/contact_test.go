@@ -0,0 +1,47 @@
+package handlers
+
+import "testing"
+
+func TestValidatePhone(t *testing.T) {
+	tests := []struct {
+		phone string
+		valid bool
+	}{
+		{"+14075551234", true},
+		{"+123456789012345", true},
+		{"+1234567890123456", false},
+		{"+01234567", false},
+		{"14075551234", false},
+		{"+1 407 555 1234", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if err := validatePhone("phone", tt.phone); (err == nil) != tt.valid {
+			t.Errorf("%q: error %v, want valid %v", tt.phone, err, tt.valid)
+		}
+	}
+}
+
+// Stored details from before they were validated are dropped, not refused
+func TestResolveEventContactSkipsInvalidDefaults(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+	_, err := db.Exec(`UPDATE public."Users" SET phone = '555-1234', email = 'not an email' WHERE user_id = $1`, f.student.UserID)
+	if err != nil {
+		t.Fatalf("storing legacy contact details: %v", err)
+	}
+
+	event := EventForm{}
+	if err = resolveEventContact(db, f.student.UserID, &event); err != nil {
+		t.Fatalf("resolving the contact: %v", err)
+	}
+	if event.ContactPhone != "" || event.ContactEmail != "" {
+		t.Errorf("contact %q %q, want both empty", event.ContactPhone, event.ContactEmail)
+	}
+
+	event = EventForm{ContactPhone: "555-1234"}
+	if err = resolveEventContact(db, f.student.UserID, &event); err == nil {
+		t.Errorf("a malformed phone from the client was accepted")
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-chi/jwtauth"
+	"github.com/lib/pq"
+)
+
+// Tests that need Postgres run against the database named by PG_USER, PG_PW
+// and PG_DB, set up with SQL/setup/setup.sql. They are skipped when PG_DB is
+// not set.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	if os.Getenv("PG_DB") == "" {
+		t.Skip("PG_DB is not set, skipping the database tests")
+	}
+
+	db, err := connectToDB()
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		t.Fatalf("connecting to the database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// Marks the request as coming from the user, the way jwtauth.Verifier does
+func asUser(t *testing.T, r *http.Request, username string) *http.Request {
+	t.Helper()
+	token, _, err := jwtauth.New("HS256", []byte("test"), nil).Encode(map[string]interface{}{"username": username})
+	if err != nil {
+		t.Fatalf("encoding the token: %v", err)
+	}
+	return r.WithContext(jwtauth.NewContext(r.Context(), token, nil))
+}
+
+// Rows a test creates, removed again when it ends. Events are far in the
+// future, and each fixture gets its own building far from anything else,
+// so the overlap trigger and the radius searches only see the fixture.
+type testFixture struct {
+	suffix   string
+	uniId    int
+	student  SessionUser
+	locId    int
+	lat, lng float64
+	// An in-person event at locId and an online one, both public
+	inPerson int
+	online   int
+	start    time.Time
+
+	unis, users, locations, events []int
+}
+
+func newFixture(t *testing.T, db *sql.DB) *testFixture {
+	t.Helper()
+	f := &testFixture{
+		suffix: fmt.Sprint(time.Now().UnixNano()),
+		lat:    -60 + rand.Float64(),
+		lng:    -170 + rand.Float64(),
+	}
+	f.start = time.Date(2999, time.January, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(rand.Intn(100000)) * 24 * time.Hour)
+
+	t.Cleanup(func() {
+		statements := []struct {
+			query string
+			args  []interface{}
+		}{
+			{`DELETE FROM public."Event_Feedback" WHERE event_id = ANY($1)`, []interface{}{pq.Array(f.events)}},
+			{`DELETE FROM public."Event_Hosts" WHERE event_id = ANY($1)`, []interface{}{pq.Array(f.events)}},
+			{`DELETE FROM public."Event_Invitations" WHERE event_id = ANY($1)`, []interface{}{pq.Array(f.events)}},
+			{`DELETE FROM public."Event_Status_History" WHERE event_id = ANY($1)`, []interface{}{pq.Array(f.events)}},
+			{`DELETE FROM public."user_event_membership" WHERE event_id = ANY($1)`, []interface{}{pq.Array(f.events)}},
+			{`DELETE FROM public."Events" WHERE event_id = ANY($1)`, []interface{}{pq.Array(f.events)}},
+			{`DELETE FROM public."Locations" WHERE loc_id = ANY($1)`, []interface{}{pq.Array(f.locations)}},
+			{`DELETE FROM public."User_RSO_Membership" WHERE user_id = ANY($1)`, []interface{}{pq.Array(f.users)}},
+			{`DELETE FROM public."RSO_Admin_Transfers" WHERE from_user = ANY($1) OR to_user = ANY($1)`, []interface{}{pq.Array(f.users)}},
+			{`DELETE FROM public."RSOs" WHERE admin_id = ANY($1)`, []interface{}{pq.Array(f.users)}},
+			{`DELETE FROM public."Superadmin_Universities" WHERE user_id = ANY($1)`, []interface{}{pq.Array(f.users)}},
+			{`DELETE FROM public."Users" WHERE user_id = ANY($1)`, []interface{}{pq.Array(f.users)}},
+			{`DELETE FROM public."Universities" WHERE uni_id = ANY($1)`, []interface{}{pq.Array(f.unis)}},
+		}
+		for _, s := range statements {
+			if _, err := db.Exec(s.query, s.args...); err != nil {
+				t.Errorf("cleanup failed on %q: %v", s.query, err)
+			}
+		}
+	})
+
+	f.uniId = f.addUni(t, db, "Test U")
+	f.student = f.addUser(t, db, "student", f.uniId, "student")
+
+	err := db.QueryRow(`INSERT INTO public."Locations" (address, latitude, longitude) VALUES ($1, $2, $3) RETURNING loc_id`,
+		"Test Hall "+f.suffix, f.lat, f.lng).Scan(&f.locId)
+	if err != nil {
+		t.Fatalf("creating the location: %v", err)
+	}
+	f.locations = append(f.locations, f.locId)
+
+	f.inPerson = f.addEvent(t, db, "in person", 0, "public", f.uniId, nil, f.locId)
+	f.online = f.addEvent(t, db, "online", 2*time.Hour, "public", f.uniId, nil, nil)
+
+	return f
+}
+
+func (f *testFixture) addUni(t *testing.T, db *sql.DB, name string) int {
+	t.Helper()
+	var uniId int
+	err := db.QueryRow(`INSERT INTO public."Universities" (name) VALUES ($1) RETURNING uni_id`, name+" "+f.suffix).Scan(&uniId)
+	if err != nil {
+		t.Fatalf("creating the university: %v", err)
+	}
+	f.unis = append(f.unis, uniId)
+	return uniId
+}
+
+func (f *testFixture) addUser(t *testing.T, db *sql.DB, name string, uniId int, userType string) SessionUser {
+	t.Helper()
+	user := SessionUser{UserName: "test_" + name + "_" + f.suffix, UniId: uniId, UserType: userType}
+	query := `INSERT INTO public."Users" (username, "password", uni_id, user_type) VALUES ($1, 'x', $2, $3) RETURNING user_id`
+	if err := db.QueryRow(query, user.UserName, uniId, userType).Scan(&user.UserID); err != nil {
+		t.Fatalf("creating the user %s: %v", name, err)
+	}
+	f.users = append(f.users, user.UserID)
+	return user
+}
+
+// A building near the fixture's, or a room of parentId when it is not nil
+func (f *testFixture) addLocation(t *testing.T, db *sql.DB, address string, parentId interface{}, capacity interface{}) int {
+	t.Helper()
+	lat, lng := interface{}(f.lat+0.0001), interface{}(f.lng)
+	if parentId != nil {
+		lat, lng = nil, nil
+	}
+
+	var locId int
+	query := `INSERT INTO public."Locations" (address, latitude, longitude, parent_id, capacity) VALUES ($1, $2, $3, $4, $5) RETURNING loc_id`
+	if err := db.QueryRow(query, address+" "+f.suffix, lat, lng, parentId, capacity).Scan(&locId); err != nil {
+		t.Fatalf("creating the location %s: %v", address, err)
+	}
+	f.locations = append(f.locations, locId)
+	return locId
+}
+
+// The event starts offset after the fixture's start. Without a location it
+// is an online event.
+func (f *testFixture) addEvent(t *testing.T, db *sql.DB, name string, offset time.Duration, visibility string,
+	uniId int, rsoId interface{}, locId interface{}) int {
+	t.Helper()
+	start := f.start.Add(offset)
+	mode, url, platform := "in_person", interface{}(nil), interface{}(nil)
+	if locId == nil {
+		mode, url, platform = "online", "https://example.com/"+f.suffix, "other"
+	}
+
+	var eventId int
+	query := `INSERT INTO public."Events" (name, start_time, end_time, visibility, uni_id, rso_id, loc_id, attendance_mode, meeting_url, meeting_platform)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING event_id`
+	err := db.QueryRow(query, "Test "+name+" "+f.suffix, start, start.Add(time.Hour), visibility, uniId, rsoId, locId,
+		mode, url, platform).Scan(&eventId)
+	if err != nil {
+		t.Fatalf("creating the event %s: %v", name, err)
+	}
+	f.events = append(f.events, eventId)
+	return eventId
+}
+
+// An RSO with the user as its admin and only member
+func (f *testFixture) addRSO(t *testing.T, db *sql.DB, name string, uniId int, admin SessionUser) int {
+	t.Helper()
+	var rsoId int
+	query := `INSERT INTO public."RSOs" (name, uni_id, admin_id, date_created) VALUES ($1, $2, $3, CURRENT_TIMESTAMP) RETURNING rso_id`
+	if err := db.QueryRow(query, "Test "+name+" "+f.suffix, uniId, admin.UserID).Scan(&rsoId); err != nil {
+		t.Fatalf("creating the RSO %s: %v", name, err)
+	}
+	_, err := db.Exec(`INSERT INTO public."User_RSO_Membership" (user_id, rso_id, role) VALUES ($1, $2, 'admin')`, admin.UserID, rsoId)
+	if err != nil {
+		t.Fatalf("adding the admin of %s: %v", name, err)
+	}
+	return rsoId
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/lib/pq"
+)
+
+const (
+	// Buildings this close are taken for the same place whatever their name
+	duplicateRadius = 50
+	maxSuggestions  = 5
+)
+
+var errInvalidMerge = errors.New("invalid merge")
+
+type LocationMatch struct {
+	Location
+	// Trigram similarity of the normalised addresses, from 0 to 1
+	Similarity float64  `json:"similarity"`
+	Distance   *float64 `json:"distance_m"`
+}
+
+type MergeForm struct {
+	IntoId int `json:"into_id"`
+}
+
+// Places that look like the candidate: a similar address or, for buildings,
+// a position within duplicateRadius. Rooms are only compared with the other
+// rooms of their building unless anyParent is set. excludeId leaves a place
+// out, 0 for none.
+func findSimilarLocations(db querier, candidate Location, excludeId int, anyParent bool) ([]LocationMatch, error) {
+	query := `SELECT ` + locationColumns + `, similarity(l.normalized_address, public.normalize_address($1)) AS score,
+			CASE WHEN l.latitude IS NOT NULL THEN ` + distanceFrom("$2", "$3") + ` END AS distance
+			FROM public."Locations" l
+			WHERE l.loc_id <> $4
+			AND ($5 OR l.parent_id IS NOT DISTINCT FROM $6)
+			AND (l.normalized_address % public.normalize_address($1)
+				OR ($6::integer IS NULL AND ` + withinRadius("$2", "$3", "$7") + `))
+			ORDER BY score DESC, distance NULLS LAST
+			LIMIT $8`
+
+	rows, err := db.Query(query, candidate.Address, candidate.Latitude, candidate.Longitude, excludeId,
+		anyParent, candidate.ParentId, duplicateRadius, maxSuggestions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []LocationMatch{}
+	for rows.Next() {
+		var match LocationMatch
+		err = rows.Scan(append(locationFields(&match.Location), &match.Similarity, &match.Distance)...)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+
+	return matches, rows.Err()
+}
+
+// Moves the events and rooms of one place to another and deletes it. The
+// surviving place keeps its own details and takes the other's where it has
+// none. Returns how many events moved.
+func mergeLocations(db *sql.DB, locId int, intoId int) (int64, error) {
+	if locId == intoId {
+		return 0, fmt.Errorf("%w: a location cannot be merged into itself", errInvalidMerge)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Both rows are locked in the order of their ids, so that two merges of
+	// the same pair in opposite directions cannot deadlock
+	parents := map[int]sql.NullInt32{}
+	query := `SELECT loc_id, parent_id FROM public."Locations" WHERE loc_id IN ($1, $2) ORDER BY loc_id FOR UPDATE`
+	rows, err := tx.Query(query, locId, intoId)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var id int
+		var parent sql.NullInt32
+		if err = rows.Scan(&id, &parent); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		parents[id] = parent
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(parents) != 2 {
+		return 0, sql.ErrNoRows
+	}
+
+	var rooms int
+
+	err = tx.QueryRow(`SELECT COUNT(*) FROM public."Locations" WHERE parent_id = $1`, locId).Scan(&rooms)
+	if err != nil {
+		return 0, err
+	}
+	if rooms > 0 && parents[intoId].Valid {
+		return 0, fmt.Errorf("%w: a building with rooms cannot be merged into a room", errInvalidMerge)
+	}
+	if parents[intoId].Valid && int(parents[intoId].Int32) == locId {
+		return 0, fmt.Errorf("%w: a building cannot be merged into one of its rooms", errInvalidMerge)
+	}
+
+	// The overlap trigger checks every moved event against the bookings of
+	// the surviving place
+	result, err := tx.Exec(`UPDATE public."Events" SET loc_id = $1 WHERE loc_id = $2`, intoId, locId)
+	if err != nil {
+		return 0, err
+	}
+	moved, _ := result.RowsAffected()
+
+	_, err = tx.Exec(`UPDATE public."Locations" SET parent_id = $1 WHERE parent_id = $2`, intoId, locId)
+	if err != nil {
+		return 0, err
+	}
+
+	query = `UPDATE public."Locations" s SET
+			latitude = COALESCE(s.latitude, d.latitude),
+			longitude = COALESCE(s.longitude, d.longitude),
+			capacity = COALESCE(s.capacity, d.capacity),
+			directions = COALESCE(s.directions, d.directions),
+			accessibility = ARRAY(SELECT DISTINCT unnest(s.accessibility || d.accessibility))
+			FROM public."Locations" d
+			WHERE s.loc_id = $1 AND d.loc_id = $2`
+	if _, err = tx.Exec(query, intoId, locId); err != nil {
+		return 0, err
+	}
+
+	// Upcoming events must still fit the surviving room, the same as when
+	// they were created there
+	var name string
+	query = `SELECT e.name FROM public."Events" e
+			JOIN public."Locations" l ON l.loc_id = e.loc_id
+			WHERE e.loc_id = $1 AND e.status IN ('scheduled', 'postponed') AND l.capacity IS NOT NULL
+			AND (e.capacity > l.capacity OR
+				(SELECT COUNT(*) FROM public."user_event_membership" m WHERE m.event_id = e.event_id) > COALESCE(e.capacity, l.capacity))
+			LIMIT 1`
+	err = tx.QueryRow(query, intoId).Scan(&name)
+	if err == nil {
+		return 0, fmt.Errorf("%w: %s needs more room than the location holds", errInvalidMerge, name)
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	if _, err = tx.Exec(`DELETE FROM public."Locations" WHERE loc_id = $1`, locId); err != nil {
+		return 0, err
+	}
+
+	return moved, tx.Commit()
+}
+
+// Places that may be duplicates of this one, most alike first
+func GetLocationDuplicates(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	locId, err := strconv.Atoi(chi.URLParam(r, "locId"))
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Location not found",
+		})
+		return
+	}
+
+	var location Location
+	query := `SELECT ` + locationColumns + ` FROM public."Locations" l WHERE l.loc_id = $1`
+	err = db.QueryRow(query, locId).Scan(locationFields(&location)...)
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Location not found",
+		})
+		return
+	}
+
+	matches, err := findSimilarLocations(db, location, locId, false)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error looking for duplicates",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data":   matches,
+	})
+}
+
+// Auth token required...
+// Merges the location into the one named by into_id, which every event
+// booked at it moves to. Locations are shared by all universities, so only
+// the platform superadmin merges them.
+func MergeLocation(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	if !requirePlatformAdmin(w, r, user) {
+		return
+	}
+
+	locId, err := strconv.Atoi(chi.URLParam(r, "locId"))
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Location not found",
+		})
+		return
+	}
+
+	var form MergeForm
+	if err = json.NewDecoder(r.Body).Decode(&form); err != nil || form.IntoId == 0 {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "into_id is required",
+		})
+		return
+	}
+
+	moved, err := mergeLocations(db, locId, form.IntoId)
+	if err != nil {
+		var pgerr *pq.Error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Location not found",
+			})
+		case errors.Is(err, errInvalidMerge):
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": err.Error(),
+			})
+		case errors.As(err, &pgerr) && pgerr.Code == "P0001":
+			// Two of the events would book the surviving place at once
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": pgerr.Message,
+			})
+		default:
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "error",
+				"message": "Database error: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":       "success",
+		"message":      "Locations merged",
+		"loc_id":       form.IntoId,
+		"events_moved": moved,
+	})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// A duplicate building is suggested, and merging it moves its events and
+// rooms to the building that stays
+func TestMergeLocationsMovesEventsAndRooms(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+	duplicate := f.addLocation(t, db, "Test Hall", nil, nil)
+	room := f.addLocation(t, db, "Room 101", duplicate, nil)
+	eventId := f.addEvent(t, db, "at the duplicate", 4*time.Hour, "public", f.uniId, nil, duplicate)
+
+	var location Location
+	query := `SELECT ` + locationColumns + ` FROM public."Locations" l WHERE l.loc_id = $1`
+	if err := db.QueryRow(query, duplicate).Scan(locationFields(&location)...); err != nil {
+		t.Fatalf("reading the duplicate: %v", err)
+	}
+	matches, err := findSimilarLocations(db, location, duplicate, false)
+	if err != nil {
+		t.Fatalf("finding similar locations: %v", err)
+	}
+	if len(matches) == 0 || matches[0].LocId != f.locId {
+		t.Errorf("suggested %+v, want the fixture's building first", matches)
+	}
+
+	moved, err := mergeLocations(db, duplicate, f.locId)
+	if err != nil {
+		t.Fatalf("merging: %v", err)
+	}
+	if moved != 1 {
+		t.Errorf("moved %d events, want 1", moved)
+	}
+
+	var locId, parentId int
+	if err = db.QueryRow(`SELECT loc_id FROM public."Events" WHERE event_id = $1`, eventId).Scan(&locId); err != nil || locId != f.locId {
+		t.Errorf("event at %d, %v, want %d", locId, err, f.locId)
+	}
+	if err = db.QueryRow(`SELECT parent_id FROM public."Locations" WHERE loc_id = $1`, room).Scan(&parentId); err != nil || parentId != f.locId {
+		t.Errorf("room in %d, %v, want %d", parentId, err, f.locId)
+	}
+	if err = db.QueryRow(`SELECT loc_id FROM public."Locations" WHERE loc_id = $1`, duplicate).Scan(&locId); err != sql.ErrNoRows {
+		t.Errorf("the duplicate is still there: %v", err)
+	}
+}
+
+// Merges that would double-book the surviving place or overfill it are
+// refused and change nothing
+func TestMergeLocationsConflicts(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+
+	overlapping := f.addLocation(t, db, "Test Hall", nil, nil)
+	f.addEvent(t, db, "at the same time", 0, "public", f.uniId, nil, overlapping)
+	_, err := mergeLocations(db, overlapping, f.locId)
+	var pgerr *pq.Error
+	if !errors.As(err, &pgerr) || pgerr.Code != "P0001" {
+		t.Errorf("merging a double booking: got %v, want the overlap error", err)
+	}
+
+	small := f.addLocation(t, db, "Small room", f.locId, 10)
+	large := f.addLocation(t, db, "Large room", f.locId, nil)
+	eventId := f.addEvent(t, db, "crowded", 8*time.Hour, "public", f.uniId, nil, large)
+	if _, err = db.Exec(`UPDATE public."Events" SET capacity = 50 WHERE event_id = $1`, eventId); err != nil {
+		t.Fatalf("setting the capacity: %v", err)
+	}
+	if _, err = mergeLocations(db, large, small); !errors.Is(err, errInvalidMerge) {
+		t.Errorf("merging into a smaller room: got %v, want %v", err, errInvalidMerge)
+	}
+
+	var count int
+	err = db.QueryRow(`SELECT COUNT(*) FROM public."Locations" WHERE loc_id IN ($1, $2)`, overlapping, large).Scan(&count)
+	if err != nil || count != 2 {
+		t.Errorf("%d of the refused locations left, %v, want 2", count, err)
+	}
+}
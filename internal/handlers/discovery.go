@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/lib/pq"
+)
+
+// The values of the categories enum, shared by event tags and RSO categories
+var validCategories = []string{"social", "fundraising", "tech talk", "academic"}
+
+// How far back events count towards an RSO's activity
+const activityWindow = "90 days"
+
+// Sort orders of the RSO listing
+var rsoSorts = map[string]string{
+	"name":     "r.name",
+	"size":     "member_count DESC, r.name",
+	"activity": "event_count DESC, r.name",
+	"newest":   "r.date_created DESC",
+}
+
+type RsoSummary struct {
+	RsoId       int            `json:"rso_id"`
+	Name        string         `json:"rso_name"`
+	Description sql.NullString `json:"description"`
+	Categories  []string       `json:"categories"`
+	MemberCount int            `json:"member_count"`
+	EventCount  int            `json:"event_count"`
+	Active      bool           `json:"active"`
+	JoinPolicy  string         `json:"join_policy"`
+	DateCreated string         `json:"date_created"`
+	LogoURL     *string        `json:"logo_url"`
+	// Only set on recommendations
+	Score *int `json:"score,omitempty"`
+}
+
+func validateCategories(categories []string) error {
+	for _, category := range categories {
+		valid := false
+		for _, c := range validCategories {
+			if category == c {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return errors.New("categories must be among " + strings.Join(validCategories, ", "))
+		}
+	}
+	return nil
+}
+
+// Member and event counts of each RSO, events counting from activityWindow ago
+const rsoSummaryColumns = `r.rso_id, r.name, r.description, r.categories, r.active, r.join_policy, r.date_created, r.logo_id,
+		(SELECT COUNT(*) FROM public."User_RSO_Membership" m WHERE m.rso_id = r.rso_id) AS member_count,
+		(SELECT COUNT(*) FROM public."Events" e WHERE e.rso_id = r.rso_id AND e.status <> 'cancelled'
+			AND e.end_time > CURRENT_TIMESTAMP - INTERVAL '` + activityWindow + `') AS event_count`
+
+func scanRsoSummaries(rows *sql.Rows, withScore bool) ([]RsoSummary, error) {
+	defer rows.Close()
+
+	var rsos []RsoSummary
+	for rows.Next() {
+		var rso RsoSummary
+		var logo sql.NullInt32
+		dest := []interface{}{&rso.RsoId, &rso.Name, &rso.Description, pq.Array(&rso.Categories), &rso.Active,
+			&rso.JoinPolicy, &rso.DateCreated, &logo, &rso.MemberCount, &rso.EventCount}
+		if withScore {
+			rso.Score = new(int)
+			dest = append(dest, rso.Score)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		rso.LogoURL = mediaURL(logo)
+		rsos = append(rsos, rso)
+	}
+
+	return rsos, rows.Err()
+}
+
+// RSOs of the university matching the ?q=, ?category= and ?sort= of the
+// request. The categories must have been validated.
+func searchRSOs(db querier, r *http.Request, uniId int) ([]RsoSummary, error) {
+	params := r.URL.Query()
+
+	sort, ok := rsoSorts[params.Get("sort")]
+	if !ok {
+		sort = rsoSorts["name"]
+	}
+
+	// Never nil, pq.Array(nil) would send NULL and match no RSO
+	categories := append([]string{}, params["category"]...)
+
+	page, perPage := parsePage(r)
+
+	query := `SELECT ` + rsoSummaryColumns + `
+			FROM public."RSOs" r
+			WHERE r.uni_id = $1 AND r.archived_at IS NULL
+			AND ($2 = '' OR r.name ILIKE '%' || $2 || '%' OR r.description ILIKE '%' || $2 || '%')
+			AND (COALESCE(cardinality($3::public.categories[]), 0) = 0 OR r.categories && $3::public.categories[])
+			ORDER BY ` + sort + `
+			LIMIT $4 OFFSET $5`
+
+	search := strings.TrimSpace(params.Get("q"))
+	// The search is a plain substring, not a pattern
+	search = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(search)
+
+	rows, err := db.Query(query, uniId, search, pq.Array(categories), perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanRsoSummaries(rows, false)
+}
+
+// Auth token required...
+// RSOs the user could join, ranked by how well their categories match the
+// categories of the user's RSOs and the tags of the events they attended.
+// Users with no history get the biggest RSOs.
+func GetRecommendedRSOs(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 || limit > maxPageSize {
+		limit = 10
+	}
+
+	query := `WITH interests AS (
+				SELECT unnest(r.categories) AS category
+				FROM public."RSOs" r
+				JOIN public."User_RSO_Membership" m ON m.rso_id = r.rso_id
+				WHERE m.user_id = $1
+				UNION ALL
+				SELECT unnest(e.tags)
+				FROM public."Events" e
+				JOIN public.user_event_membership uem ON uem.event_id = e.event_id
+				WHERE uem.user_id = $1
+			), weights AS (
+				SELECT category, COUNT(*) AS weight FROM interests GROUP BY category
+			)
+			SELECT ` + rsoSummaryColumns + `,
+			COALESCE((SELECT SUM(w.weight) FROM weights w WHERE w.category = ANY (r.categories)), 0)::int AS score
+			FROM public."RSOs" r
+			WHERE r.uni_id = $2 AND r.archived_at IS NULL AND r.join_policy <> 'invite_only'
+			AND NOT EXISTS (SELECT 1 FROM public."User_RSO_Membership" m WHERE m.rso_id = r.rso_id AND m.user_id = $1)
+			ORDER BY score DESC, member_count DESC, r.name
+			LIMIT $3`
+
+	rows, err := db.Query(query, user.UserID, user.UniId, limit)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting recommendations",
+		})
+		return
+	}
+
+	rsos, err := scanRsoSummaries(rows, true)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting recommendations",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data":   rsos,
+	})
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateCategories(t *testing.T) {
+	tests := []struct {
+		categories []string
+		wantErr    bool
+	}{
+		{nil, false},
+		{[]string{"social", "tech talk"}, false},
+		{[]string{"social", "sports"}, true},
+	}
+
+	for _, tt := range tests {
+		if err := validateCategories(tt.categories); (err != nil) != tt.wantErr {
+			t.Errorf("%v: error %v, want error %v", tt.categories, err, tt.wantErr)
+		}
+	}
+}
+
+// Without ?category= every RSO of the university is listed
+func TestGetAllRSOsWithoutCategory(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+	rsoId := f.addRSO(t, db, "club", f.uniId, f.student)
+
+	r := asUser(t, httptest.NewRequest(http.MethodGet, "/", nil), f.student.UserName)
+	w := httptest.NewRecorder()
+	GetAllRSOs(w, r)
+
+	var body struct {
+		Data []RsoSummary `json:"data"`
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+	for _, rso := range body.Data {
+		if rso.RsoId == rsoId {
+			return
+		}
+	}
+	t.Errorf("RSO %d missing from %d RSOs", rsoId, len(body.Data))
+}
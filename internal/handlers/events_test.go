@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// Only users who can see an event join it and get its meeting link
+func TestJoinEventVisibility(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+	f.addEvent(t, db, "private", 4*time.Hour, "invite_only", f.uniId, nil, nil)
+
+	tests := []struct {
+		event      string
+		wantStatus int
+		wantLink   bool
+	}{
+		{"Test online " + f.suffix, http.StatusAccepted, true},
+		{"Test private " + f.suffix, http.StatusNotFound, false},
+	}
+
+	for _, tt := range tests {
+		body := strings.NewReader(`{"event_name": "` + tt.event + `"}`)
+		r := asUser(t, httptest.NewRequest(http.MethodPost, "/join", body), f.student.UserName)
+		w := httptest.NewRecorder()
+		JoinEvent(w, r)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d: %s", tt.event, w.Code, tt.wantStatus, w.Body.String())
+			continue
+		}
+		var response map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Errorf("%s: decoding %q: %v", tt.event, w.Body.String(), err)
+			continue
+		}
+		if _, ok := response["meeting_url"]; ok != tt.wantLink {
+			t.Errorf("%s: meeting_url given %v, want %v", tt.event, ok, tt.wantLink)
+		}
+	}
+}
+
+// Users joining at once cannot take more seats than the event has
+func TestJoinEventCapacity(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+	if _, err := db.Exec(`UPDATE public."Events" SET capacity = 1 WHERE event_id = $1`, f.online); err != nil {
+		t.Fatalf("setting the capacity: %v", err)
+	}
+
+	codes := make([]int, 5)
+	var wg sync.WaitGroup
+	for i := range codes {
+		user := f.addUser(t, db, fmt.Sprint("joiner", i), f.uniId, "student")
+		body := strings.NewReader(`{"event_name": "Test online ` + f.suffix + `"}`)
+		r := asUser(t, httptest.NewRequest(http.MethodPost, "/join", body), user.UserName)
+		wg.Add(1)
+		go func(i int, r *http.Request) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			JoinEvent(w, r)
+			codes[i] = w.Code
+		}(i, r)
+	}
+	wg.Wait()
+
+	joined := 0
+	for _, code := range codes {
+		if code == http.StatusAccepted {
+			joined++
+		} else if code != http.StatusConflict {
+			t.Errorf("status %d, want %d or %d", code, http.StatusAccepted, http.StatusConflict)
+		}
+	}
+	if joined != 1 {
+		t.Errorf("%d users joined an event with one seat", joined)
+	}
+}
+
+// An RSO's event is created together with the RSO as its first host
+func TestCreateEventRecordsHost(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+	rsoId := f.addRSO(t, db, "hosts", f.uniId, f.student)
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	form, err := json.Marshal(map[string]interface{}{
+		"event_name":  "Test hosted " + f.suffix,
+		"start_time":  start.Format(time.RFC3339),
+		"end_time":    start.Add(time.Hour).Format(time.RFC3339),
+		"visibility":  "public",
+		"uni_name":    "Test U " + f.suffix,
+		"rso_name":    "Test hosts " + f.suffix,
+		"meeting_url": "https://example.com/" + f.suffix,
+	})
+	if err != nil {
+		t.Fatalf("encoding the form: %v", err)
+	}
+
+	r := asUser(t, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(form))), f.student.UserName)
+	w := httptest.NewRecorder()
+	CreateEvent(w, r)
+
+	var response struct {
+		EventId int `json:"event_id"`
+	}
+	if err = json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.EventId == 0 {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	f.events = append(f.events, response.EventId)
+
+	var hosted bool
+	query := `SELECT EXISTS(SELECT 1 FROM public."Event_Hosts" WHERE event_id = $1 AND rso_id = $2 AND status = 'accepted')`
+	if err = db.QueryRow(query, response.EventId, rsoId).Scan(&hosted); err != nil {
+		t.Fatalf("reading the hosts: %v", err)
+	}
+	if !hosted {
+		t.Errorf("the RSO is not a host of the event it created")
+	}
+}
+
+// Clients naming the old Online location get an online event, or a 400
+// without a meeting link
+func TestCreateEventLegacyOnline(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name       string
+		meetingURL string
+		wantStatus int
+	}{
+		{"legacy online", "https://example.com/legacy", http.StatusOK},
+		{"legacy no link", "", http.StatusBadRequest},
+	}
+
+	for i, tt := range tests {
+		eventStart := start.Add(time.Duration(i) * 2 * time.Hour)
+		form, err := json.Marshal(map[string]interface{}{
+			"event_name":  "Test " + tt.name + " " + f.suffix,
+			"start_time":  eventStart.Format(time.RFC3339),
+			"end_time":    eventStart.Add(time.Hour).Format(time.RFC3339),
+			"visibility":  "public",
+			"uni_name":    "Test U " + f.suffix,
+			"loc_name":    "Online",
+			"meeting_url": tt.meetingURL,
+		})
+		if err != nil {
+			t.Fatalf("encoding the form: %v", err)
+		}
+
+		r := asUser(t, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(form))), f.student.UserName)
+		w := httptest.NewRecorder()
+		CreateEvent(w, r)
+
+		var response struct {
+			EventId int `json:"event_id"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		if response.EventId != 0 {
+			f.events = append(f.events, response.EventId)
+		}
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.wantStatus, w.Body.String())
+			continue
+		}
+
+		if response.EventId != 0 {
+			var mode string
+			err = db.QueryRow(`SELECT attendance_mode FROM public."Events" WHERE event_id = $1`, response.EventId).Scan(&mode)
+			if err != nil || mode != "online" {
+				t.Errorf("%s: attendance mode %q, %v, want online", tt.name, mode, err)
+			}
+		}
+	}
+}
+
+// Organisers of an invite-only event join it without inviting themselves
+func TestJoinEventInviteOnlyCreator(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+	eventId := f.addEvent(t, db, "own", 4*time.Hour, "invite_only", f.uniId, nil, nil)
+	if _, err := db.Exec(`UPDATE public."Events" SET created_by = $1 WHERE event_id = $2`, f.student.UserID, eventId); err != nil {
+		t.Fatalf("setting the creator: %v", err)
+	}
+
+	body := strings.NewReader(`{"event_name": "Test own ` + f.suffix + `"}`)
+	r := asUser(t, httptest.NewRequest(http.MethodPost, "/join", body), f.student.UserName)
+	w := httptest.NewRecorder()
+	JoinEvent(w, r)
+
+	if w.Code != http.StatusAccepted {
+		t.Errorf("status %d, want %d: %s", w.Code, http.StatusAccepted, w.Body.String())
+	}
+}
+
+// Check-in is refused before the event starts and once it is cancelled
+func TestAttendEventOnlyWhileOpen(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+	organiser := f.addUser(t, db, "organiser", f.uniId, "student")
+	if _, err := db.Exec(`UPDATE public."Events" SET created_by = $1 WHERE event_id = $2`, organiser.UserID, f.online); err != nil {
+		t.Fatalf("setting the creator: %v", err)
+	}
+
+	router := chi.NewRouter()
+	router.Put("/{eventId}/attendance/{username}", AttendEvent)
+	attend := func() int {
+		target := fmt.Sprintf("/%d/attendance/%s", f.online, f.student.UserName)
+		r := asUser(t, httptest.NewRequest(http.MethodPut, target, nil), organiser.UserName)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := attend(); code != http.StatusConflict {
+		t.Errorf("before the start: status %d, want %d", code, http.StatusConflict)
+	}
+
+	query := `UPDATE public."Events" SET start_time = CURRENT_TIMESTAMP - interval '1 hour',
+			end_time = CURRENT_TIMESTAMP + interval '1 hour', status = $2 WHERE event_id = $1`
+	if _, err := db.Exec(query, f.online, "cancelled"); err != nil {
+		t.Fatalf("cancelling the event: %v", err)
+	}
+	if code := attend(); code != http.StatusConflict {
+		t.Errorf("cancelled: status %d, want %d", code, http.StatusConflict)
+	}
+
+	if _, err := db.Exec(query, f.online, "scheduled"); err != nil {
+		t.Fatalf("starting the event: %v", err)
+	}
+	if code := attend(); code != http.StatusOK {
+		t.Errorf("started: status %d, want %d", code, http.StatusOK)
+	}
+}
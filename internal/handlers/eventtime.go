@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	// Ship the zone database with the binary so LoadLocation works on slim images
+	_ "time/tzdata"
+)
+
+const (
+	maxEventDuration = 7 * 24 * time.Hour
+	maxEventLeadTime = 2 * 365 * 24 * time.Hour
+	// Small grace period so an event "starting now" isn't rejected by clock skew
+	maxEventPastStart = 1 * time.Hour
+)
+
+var errEndBeforeStart = errors.New("end_time must be after start_time")
+
+// Times of an event both in UTC and in the event's own time zone. Embedded
+// into the event structs so every response carries both.
+type EventTimes struct {
+	StartTime      string `json:"start_time"`
+	EndTime        string `json:"end_time"`
+	StartTimeLocal string `json:"start_time_local"`
+	EndTimeLocal   string `json:"end_time_local"`
+	TimeZone       string `json:"time_zone"`
+}
+
+func newEventTimes(start time.Time, end time.Time, zone string) EventTimes {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		loc = time.UTC
+		zone = "UTC"
+	}
+
+	return EventTimes{
+		StartTime:      start.UTC().Format(time.RFC3339),
+		EndTime:        end.UTC().Format(time.RFC3339),
+		StartTimeLocal: start.In(loc).Format(time.RFC3339),
+		EndTimeLocal:   end.In(loc).Format(time.RFC3339),
+		TimeZone:       zone,
+	}
+}
+
+// Checks the zone is a valid IANA name, e.g. "America/New_York"
+func validateTimeZone(zone string) error {
+	if zone == "" {
+		return errors.New("time zone is required")
+	}
+
+	// LoadLocation also takes "Local", the zone of whatever server runs this
+	_, err := time.LoadLocation(zone)
+	if err != nil || zone == "Local" {
+		return fmt.Errorf("unknown time zone %q", zone)
+	}
+
+	return nil
+}
+
+// Parses the RFC 3339 start and end of an event and checks they make sense:
+// the end comes after the start, the event isn't longer than a week, and it
+// starts neither in the past nor more than two years ahead.
+func parseEventTimes(startTime string, endTime string) (time.Time, time.Time, error) {
+	start, err := time.Parse(time.RFC3339, startTime)
+	if err != nil {
+		return start, start, fmt.Errorf("start_time must be an RFC 3339 timestamp, e.g. 2024-04-20T18:00:00-04:00")
+	}
+
+	end, err := time.Parse(time.RFC3339, endTime)
+	if err != nil {
+		return start, end, fmt.Errorf("end_time must be an RFC 3339 timestamp, e.g. 2024-04-20T20:00:00-04:00")
+	}
+
+	if !end.After(start) {
+		return start, end, errEndBeforeStart
+	}
+
+	if end.Sub(start) > maxEventDuration {
+		return start, end, fmt.Errorf("events cannot last longer than %d days", int(maxEventDuration.Hours()/24))
+	}
+
+	now := time.Now()
+	if start.Before(now.Add(-maxEventPastStart)) {
+		return start, end, errors.New("start_time cannot be in the past")
+	}
+
+	if start.After(now.Add(maxEventLeadTime)) {
+		return start, end, errors.New("start_time cannot be more than two years ahead")
+	}
+
+	return start, end, nil
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEventTimes(t *testing.T) {
+	base := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	at := func(offset time.Duration) string { return base.Add(offset).Format(time.RFC3339) }
+
+	tests := []struct {
+		name    string
+		start   string
+		end     string
+		wantErr bool
+	}{
+		{"an hour", at(0), at(time.Hour), false},
+		{"with an offset", base.In(time.FixedZone("EDT", -4*3600)).Format(time.RFC3339), at(time.Hour), false},
+		{"a week", at(0), at(7 * 24 * time.Hour), false},
+		{"starting now", time.Now().Format(time.RFC3339), time.Now().Add(time.Hour).Format(time.RFC3339), false},
+		{"no zone", base.Format("2006-01-02T15:04:05"), at(time.Hour), true},
+		{"bad end", at(0), "tomorrow", true},
+		{"end at start", at(0), at(0), true},
+		{"end before start", at(time.Hour), at(0), true},
+		{"longer than a week", at(0), at(7*24*time.Hour + time.Second), true},
+		{"in the past", at(-48 * time.Hour), at(-47 * time.Hour), true},
+		{"too far ahead", at(3 * 365 * 24 * time.Hour), at(3*365*24*time.Hour + time.Hour), true},
+	}
+
+	for _, tt := range tests {
+		start, end, err := parseEventTimes(tt.start, tt.end)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (start.Format(time.RFC3339) != tt.start || !end.After(start)) {
+			t.Errorf("%s: got %v to %v", tt.name, start, end)
+		}
+	}
+}
+
+func TestValidateTimeZone(t *testing.T) {
+	tests := []struct {
+		zone    string
+		wantErr bool
+	}{
+		{"America/New_York", false},
+		{"UTC", false},
+		{"Asia/Kolkata", false},
+		{"", true},
+		{"Local", true},
+		{"Mars/Olympus_Mons", true},
+		{"EST5EDT,M3.2.0,M11.1.0", true},
+	}
+
+	for _, tt := range tests {
+		if err := validateTimeZone(tt.zone); (err != nil) != tt.wantErr {
+			t.Errorf("%q: error %v, want error %v", tt.zone, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNewEventTimes(t *testing.T) {
+	start := time.Date(2030, time.March, 10, 6, 30, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+
+	tests := []struct {
+		zone string
+		want EventTimes
+	}{
+		{"America/New_York", EventTimes{
+			StartTime: "2030-03-10T06:30:00Z", EndTime: "2030-03-10T08:30:00Z",
+			// Daylight saving time starts at 7:00 UTC that day
+			StartTimeLocal: "2030-03-10T01:30:00-05:00", EndTimeLocal: "2030-03-10T04:30:00-04:00",
+			TimeZone: "America/New_York",
+		}},
+		{"UTC", EventTimes{
+			StartTime: "2030-03-10T06:30:00Z", EndTime: "2030-03-10T08:30:00Z",
+			StartTimeLocal: "2030-03-10T06:30:00Z", EndTimeLocal: "2030-03-10T08:30:00Z",
+			TimeZone: "UTC",
+		}},
+		// Unknown zones stored before validation fall back to UTC
+		{"Nowhere/Else", EventTimes{
+			StartTime: "2030-03-10T06:30:00Z", EndTime: "2030-03-10T08:30:00Z",
+			StartTimeLocal: "2030-03-10T06:30:00Z", EndTimeLocal: "2030-03-10T08:30:00Z",
+			TimeZone: "UTC",
+		}},
+	}
+
+	for _, tt := range tests {
+		if got := newEventTimes(start, end, tt.zone); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.zone, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/bingKegeta/Knight-Link/internal/geocode"
+)
+
+const (
+	maxGazetteerSize = 10 << 20
+	// Only a match at least this good fills in coordinates by itself
+	autoFillScore = 0.6
+)
+
+// Imports always go to the local gazetteer, lookups go to the geocoder,
+// which main may swap for a remote one
+var gazetteer = geocode.Gazetteer{Open: connectToDB}
+var geocoder geocode.Geocoder = gazetteer
+
+func SetGeocoder(g geocode.Geocoder) {
+	geocoder = g
+}
+
+// The best place for the address when it matches well enough to trust, nil
+// when nothing does
+func geocodeAddress(ctx context.Context, uniId int, address string) (*geocode.Place, error) {
+	places, err := geocoder.Forward(ctx, uniId, address)
+	if err != nil || len(places) == 0 || places[0].Score < autoFillScore {
+		return nil, err
+	}
+	return &places[0], nil
+}
+
+func parseUniId(w http.ResponseWriter, r *http.Request) (int, bool) {
+	uniId, err := strconv.Atoi(chi.URLParam(r, "uni_id"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid university ID",
+		})
+		return 0, false
+	}
+	return uniId, true
+}
+
+// Places of the university matching ?q=, best match first
+func GeocodeAddress(w http.ResponseWriter, r *http.Request) {
+	uniId, ok := parseUniId(w, r)
+	if !ok {
+		return
+	}
+
+	address := r.URL.Query().Get("q")
+	if address == "" {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "q is required",
+		})
+		return
+	}
+
+	places, err := geocoder.Forward(r.Context(), uniId, address)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error looking up the address",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data":   places,
+	})
+}
+
+// Places of the university around ?lat= and ?lng=, closest first
+func ReverseGeocode(w http.ResponseWriter, r *http.Request) {
+	uniId, ok := parseUniId(w, r)
+	if !ok {
+		return
+	}
+
+	lat, err := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
+	var lng float64
+	if err == nil {
+		lng, err = strconv.ParseFloat(r.URL.Query().Get("lng"), 64)
+	}
+	if err == nil {
+		err = validateCoordinates(&lat, &lng)
+	}
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "lat and lng must be valid coordinates",
+		})
+		return
+	}
+
+	places, err := geocoder.Reverse(r.Context(), uniId, lat, lng)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error looking up the position",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data":   places,
+	})
+}
+
+// Auth token required...
+// Loads the buildings and addresses of the university into the gazetteer,
+// from a CSV (text/csv) or GeoJSON (application/geo+json) body. Places are
+// updated by name, ?replace=true drops those the file leaves out.
+func ImportGazetteer(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	uniId, ok := checkUniSuperadmin(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxGazetteerSize)
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var places []geocode.Place
+	switch contentType {
+	case "text/csv":
+		places, err = geocode.ParseCSV(body)
+	case "application/geo+json", "application/json":
+		places, err = geocode.ParseGeoJSON(body)
+	default:
+		render.Status(r, http.StatusUnsupportedMediaType)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Upload the gazetteer as text/csv or application/geo+json",
+		})
+		return
+	}
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	count, err := gazetteer.Import(r.Context(), uniId, places, r.URL.Query().Get("replace") == "true")
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Error importing the gazetteer: " + err.Error(),
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":   "success",
+		"message":  "Gazetteer imported",
+		"imported": count,
+	})
+}
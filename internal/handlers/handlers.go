@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"os"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi"
@@ -61,6 +63,9 @@ type EventForm struct {
 	Description    string        `json:"event_description"`
 	StartTime      string        `json:"start_time"`
 	EndTime        string        `json:"end_time"`
+	TimeZone       string        `json:"time_zone"`
+	ContactPhone   string        `json:"contact_phone"`
+	ContactEmail   string        `json:"contact_email"`
 	Location       string        `json:"loc_name"`
 	Visibility     string        `json:"visibility"`
 	UniversityName string        `json:"uni_name"`
@@ -68,41 +73,100 @@ type EventForm struct {
 	UniId          int           `json:"uni_id"`
 	RsoId          sql.NullInt32 `json:"rso_id"`
 	LocId          sql.NullInt32
+	// Picks the room by id, for rooms of different buildings sharing a name
+	VenueId int `json:"loc_id"`
+	// Capped at the room's capacity, which applies when this is left out
+	Capacity *int `json:"capacity"`
+	// Online and hybrid events are joined through a meeting link
+	MeetingURL      string `json:"meeting_url"`
+	MeetingPlatform string `json:"meeting_platform"`
 }
 
 type UserEventForm struct {
 	Name        string         `json:"event_name"`
 	Description sql.NullString `json:"event_description"`
-	StartTime   string         `json:"start_time"`
-	EndTime     string         `json:"end_time"`
-	UniId       int            `json:"uni_id"`
+	EventTimes
+	UniId        int            `json:"uni_id"`
+	Status       string         `json:"status"`
+	StatusReason sql.NullString `json:"status_reason"`
 }
 
 type DbEventForm struct {
 	Name string `json:"event_name"`
 	// Tags           []string `json:"tags"`
-	Description    sql.NullString `json:"event_description"`
-	StartTime      string         `json:"start_time"`
-	EndTime        string         `json:"end_time"`
+	Description sql.NullString `json:"event_description"`
+	EventTimes
 	Location       string         `json:"loc_name"`
 	Visibility     string         `json:"visibility"`
 	UniversityName string         `json:"uni_name"`
 	RsoName        string         `json:"rso_name"`
 	UniId          int            `json:"uni_id"`
 	RsoId          sql.NullInt32  `json:"rso_id"`
+	Status         string         `json:"status"`
+	StatusReason   sql.NullString `json:"status_reason"`
+	AttendanceMode string         `json:"attendance_mode"`
 	LocId          sql.NullInt32
 }
 
+type EventHost struct {
+	RsoId   int    `json:"rso_id"`
+	RsoName string `json:"rso_name"`
+	Status  string `json:"status"`
+}
+
+type EventDetail struct {
+	EventId     int            `json:"event_id"`
+	Name        string         `json:"event_name"`
+	Description sql.NullString `json:"event_description"`
+	EventTimes
+	Location        sql.NullString `json:"loc_name"`
+	LocId           sql.NullInt32  `json:"loc_id"`
+	Capacity        sql.NullInt32  `json:"capacity"`
+	Accessibility   []string       `json:"accessibility"`
+	Directions      sql.NullString `json:"directions"`
+	Visibility      string         `json:"visibility"`
+	UniId           int            `json:"uni_id"`
+	RsoId           sql.NullInt32  `json:"rso_id"`
+	Hosts           []EventHost    `json:"hosts"`
+	Status          string         `json:"status"`
+	StatusReason    sql.NullString `json:"status_reason"`
+	AttendanceMode  string         `json:"attendance_mode"`
+	MeetingPlatform sql.NullString `json:"meeting_platform"`
+	// Only filled in for organisers and attendees
+	ContactPhone *string `json:"contact_phone,omitempty"`
+	ContactEmail *string `json:"contact_email,omitempty"`
+	MeetingURL   *string `json:"meeting_url,omitempty"`
+}
+
 type University struct {
-	Name        string `json:"uni_name"`
-	Description string `json:"uni_description"`
-	StudentNo   int    `json:"student_no"`
+	UniId        int             `json:"uni_id"`
+	Name         string          `json:"uni_name"`
+	Description  sql.NullString  `json:"uni_description"`
+	StudentNo    int             `json:"student_no"`
+	TimeZone     string          `json:"time_zone"`
+	EmailDomains []string        `json:"email_domains"`
+	Latitude     sql.NullFloat64 `json:"latitude"`
+	Longitude    sql.NullFloat64 `json:"longitude"`
+	PictureURL   *string         `json:"picture_url"`
 }
 
+// Places whose position is not known have no coordinates. Rooms name the
+// building they are in as their parent.
 type Location struct {
-	Address   string `json:"address"`
-	Latitude  string `json:"latitude"`
-	Longitude string `json:"longitude"`
+	LocId         int      `json:"loc_id"`
+	Address       string   `json:"address"`
+	Latitude      *float64 `json:"latitude"`
+	Longitude     *float64 `json:"longitude"`
+	ParentId      *int     `json:"parent_id"`
+	Capacity      *int     `json:"capacity"`
+	Accessibility []string `json:"accessibility"`
+	Directions    *string  `json:"directions"`
+}
+
+type LocationForm struct {
+	Location
+	// Geocodes the address against this university's campus, all when 0
+	UniId int `json:"uni_id"`
 }
 
 type FeedbackForm struct {
@@ -138,19 +202,22 @@ type RsoForm struct {
 }
 
 type RsoJoin struct {
-	Username string `json:"username"`
-	RsoName  string `json:"rso_name"`
+	RsoName string `json:"rso_name"`
+	// Sent to the officers when the RSO approves its members
+	Message string `json:"message"`
 }
 
 type EventJoin struct {
+	// Only read by LeaveEvent, JoinEvent takes the user from the token
 	Username  string `json:"username"`
 	Eventname string `json:"event_name"`
 }
 
 // Function to establish a connection to the database
 func connectToDB() (*sql.DB, error) {
+	// The settings may also come from the environment, e.g. for the tests
 	err := godotenv.Load()
-	if err != nil {
+	if err != nil && os.Getenv("PG_DB") == "" {
 		log.Fatal("Error loading .env file")
 		return nil, err
 	}
@@ -273,11 +340,14 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 	// Set the password to the newly hashed password
 	user.Password = string(hashedPassword)
 
-	check := 0
-	// Actually.
-	checkStdNo := `SELECT u.student_no FROM public."Universities" u WHERE name = $1`
+	// Every user starts as a student. Admins come from approved RSOs and
+	// superadmins are assigned by the platform superadmin.
+	user.UserType = "student"
 
-	err = db.QueryRow(checkStdNo, user.University).Scan((&check))
+	// Query the DB to get the Uid
+	var domains []string
+	checkUid := `SELECT u.uni_id, u.email_domains FROM public."Universities" u WHERE name = $1 AND archived_at IS NULL`
+	err = db.QueryRow(checkUid, user.University).Scan(&user.Uid, pq.Array(&domains))
 
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
@@ -288,22 +358,11 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if check == 0 {
-		user.UserType = "admin"
-	} else {
-		// Every user is by default an student, so assign it here
-		user.UserType = "student"
-	}
-
-	// Query the DB to get the Uid
-	checkUid := `SELECT u.uni_id FROM public."Universities" u WHERE name = $1`
-	err = db.QueryRow(checkUid, user.University).Scan(&user.Uid)
-
-	if err != nil {
-		render.Status(r, http.StatusInternalServerError)
+	if !emailInDomains(user.Email, domains) {
+		render.Status(r, http.StatusBadRequest)
 		render.JSON(w, r, map[string]interface{}{
 			"Error":   "Error",
-			"message": "Error checking university" + " " + err.Error(),
+			"message": "Use your university email address to sign up",
 		})
 		return
 	}
@@ -515,50 +574,83 @@ func Logout(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, "Logout endpoint")
 }
 
-func GetAllEvents(w http.ResponseWriter, r *http.Request) {
-	username := r.URL.Query().Get("username")
+// Events the user ($1) is allowed to see: public ones, private ones of their
+// university, RSO events of the primary RSO or any accepted co-host RSO
+// they are a member of, and invite-only events they organise or were invited
+// to and have not declined. Expects the Events table to be aliased as e.
+const visibleEventClause = `(e.visibility = 'public' OR
+		  (e.visibility <> 'invite_only' AND (
+			  e.uni_id = (SELECT uni_id FROM public."Users" WHERE user_id = $1) OR
+			  e.rso_id IN (SELECT rso_id FROM public."User_RSO_Membership" WHERE user_id = $1) OR
+			  EXISTS (SELECT 1 FROM public."Event_Hosts" h
+					  JOIN public."User_RSO_Membership" m ON m.rso_id = h.rso_id
+					  WHERE h.event_id = e.event_id AND h.status = 'accepted' AND m.user_id = $1))) OR
+		  (e.visibility = 'invite_only' AND ` + inviteOnlyAccessClause + `))`
+
+// Who may see and join an invite-only event: its creator, the admins of its
+// host RSOs and the users invited to it who did not decline. Takes the user
+// as $1, for the event aliased as e.
+const inviteOnlyAccessClause = `(e.created_by = $1 OR
+		  EXISTS (SELECT 1 FROM public."Event_Hosts" h
+				  JOIN public."RSOs" r ON r.rso_id = h.rso_id
+				  WHERE h.event_id = e.event_id AND h.status = 'accepted' AND r.admin_id = $1) OR
+		  EXISTS (SELECT 1 FROM public."Event_Invitations" i
+				  WHERE i.event_id = e.event_id AND i.user_id = $1 AND i.status <> 'declined'))`
 
-	if username == "" {
+// Auth token required...
+// Public events, private events of the user's university, and events of
+// RSOs the user is a member of. The user comes from the token only, the
+// scoped transaction must never run as someone the caller merely names.
+func GetAllEvents(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
 		render.JSON(w, r, map[string]interface{}{
 			"status":  "warning",
-			"message": "No username provided",
+			"message": "Could not identify the user",
 		})
+		return
 	}
 
-	// We got a username, get the user_id, and check public events,
-	// private events of the user's attending university,
-	// and events of RSOs the user is a member of
-	// and then just return those + everything that is public
-	db, err := connectToDB()
+	// ?accessibility= keeps the events at places with those features
+	features, err := parseAccessibilityFilter(r)
 	if err != nil {
-		render.Status(r, http.StatusInternalServerError)
-		render.PlainText(w, r, err.Error())
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
 		return
 	}
 
-	defer db.Close()
-
 	var rows *sql.Rows
 
-	var userId int
-	err = db.QueryRow(`SELECT user_id FROM public."Users" WHERE username = $1`, username).Scan(&userId)
-
+	tx, err := BeginUserTx(db, user)
 	if err != nil {
-		render.Status(r, http.StatusNotFound)
+		render.Status(r, http.StatusInternalServerError)
 		render.JSON(w, r, map[string]interface{}{
-			"status":  "warning",
-			"message": "User not found",
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
 		})
 		return
 	}
+	defer tx.Rollback()
 
-	query := `SELECT e.name, e.description, e.start_time, e.end_time, e.uni_id, e.rso_id, e.visibility FROM public."Events" e
-	WHERE e.visibility = 'public' OR
-		  e.uni_id = (SELECT uni_id FROM public."Users" WHERE user_id = $1) OR
-		  e.rso_id IN (SELECT rso_id FROM public."User_RSO_Membership" WHERE user_id = $1)`
+	// Cancelled events stay in the list, flagged through their status
+	query := `SELECT e.name, e.description, e.start_time, e.end_time, e.time_zone, e.uni_id, e.rso_id, e.visibility, e.status, e.status_reason, e.attendance_mode FROM public."Events" e
+	LEFT JOIN public."Locations" l ON l.loc_id = e.loc_id
+	WHERE ` + visibleEventClause + ` AND ` + accessibleClause("$2")
 
-	rows, err = db.Query(query, userId)
+	rows, err = tx.Query(query, user.UserID, pq.Array(features))
 
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
@@ -575,7 +667,9 @@ func GetAllEvents(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var event DbEventForm
-		err = rows.Scan(&event.Name, &event.Description, &event.StartTime, &event.EndTime, &event.UniId, &event.RsoId, &event.Visibility)
+		var start, end time.Time
+		var zone string
+		err = rows.Scan(&event.Name, &event.Description, &start, &end, &zone, &event.UniId, &event.RsoId, &event.Visibility, &event.Status, &event.StatusReason, &event.AttendanceMode)
 
 		if err != nil {
 			render.Status(r, http.StatusInternalServerError)
@@ -585,6 +679,7 @@ func GetAllEvents(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
+		event.EventTimes = newEventTimes(start, end, zone)
 		events = append(events, event)
 	}
 
@@ -650,7 +745,7 @@ func GetUserEvents(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	query = `select e."name", e."description", e."start_time", e."end_time", e."uni_id" 
+	query = `select e."name", e."description", e."start_time", e."end_time", e."time_zone", e."uni_id", e."status", e."status_reason" 
 			from public."Events" e 
 			left join user_event_membership uem 
 			on 
@@ -673,7 +768,9 @@ func GetUserEvents(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var event UserEventForm
-		err = rows.Scan(&event.Name, &event.Description, &event.StartTime, &event.EndTime, &event.UniId)
+		var start, end time.Time
+		var zone string
+		err = rows.Scan(&event.Name, &event.Description, &start, &end, &zone, &event.UniId, &event.Status, &event.StatusReason)
 
 		if err != nil {
 			render.Status(r, http.StatusInternalServerError)
@@ -683,6 +780,7 @@ func GetUserEvents(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
+		event.EventTimes = newEventTimes(start, end, zone)
 		events = append(events, event)
 	}
 
@@ -701,6 +799,9 @@ func GetUserEvents(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// Auth token required...
+// Joins the event named by event_name as the token's user. Events the user
+// cannot see are not found, and only attendees get the meeting link.
 func JoinEvent(w http.ResponseWriter, r *http.Request) {
 	db, err := connectToDB()
 
@@ -714,6 +815,17 @@ func JoinEvent(w http.ResponseWriter, r *http.Request) {
 	}
 	defer db.Close()
 
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+	userId := user.UserID
+
 	var eventJoin EventJoin
 
 	err = json.NewDecoder(r.Body).Decode(&eventJoin)
@@ -727,11 +839,27 @@ func JoinEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// get event_id
+	// get event_id, only of an event the user can see, so that the meeting
+	// link never reaches anyone else. visibleEventClause takes the user as $1
 	var event_id string
-	query := `SELECT event_id FROM public."Events" WHERE name = $1`
-	err = db.QueryRow(query, eventJoin.Eventname).Scan(&event_id)
-
+	var visibility string
+	var status string
+	var meetingURL sql.NullString
+	var capacity sql.NullInt32
+	query := `SELECT e.event_id, e.visibility, e.status, e.meeting_url, COALESCE(e.capacity, l.capacity)
+			FROM public."Events" e
+			LEFT JOIN public."Locations" l ON l.loc_id = e.loc_id
+			WHERE e.name = $2 AND ` + visibleEventClause
+	err = db.QueryRow(query, userId, eventJoin.Eventname).Scan(&event_id, &visibility, &status, &meetingURL, &capacity)
+
+	if err == sql.ErrNoRows {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Event not found",
+		})
+		return
+	}
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
 		render.JSON(w, r, map[string]interface{}{
@@ -741,30 +869,6 @@ func JoinEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var userId int
-
-	// Get the userid off the username
-	query = `SELECT user_id FROM public."Users" WHERE username = $1`
-	err = db.QueryRow(query, eventJoin.Username).Scan(&userId)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			render.Status(r, http.StatusNotFound)
-			render.JSON(w, r, map[string]interface{}{
-				// This should never ever happen. But added just as precaution
-				"status":  "warning",
-				"message": "User not found",
-			})
-			return
-		} else {
-			render.Status(r, http.StatusInternalServerError)
-			render.JSON(w, r, map[string]interface{}{
-				"status":  "error",
-				"message": "Database error: " + err.Error(),
-			})
-			return
-		}
-	}
-
 	// Check if the user is already a member of the RSO
 	var exists bool
 	query = `SELECT EXISTS(SELECT 1 FROM public."user_event_membership" WHERE user_id = $1 AND event_id = $2)`
@@ -786,9 +890,83 @@ func JoinEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if status == "cancelled" || status == "completed" {
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "This event has been " + status,
+		})
+		return
+	}
+
+	// Invite-only events need an invitation that was not declined, unless
+	// the user organises the event
+	if visibility == "invite_only" {
+		var invited bool
+		query = `SELECT ` + inviteOnlyAccessClause + ` FROM public."Events" e WHERE e.event_id = $2`
+		err = db.QueryRow(query, userId, event_id).Scan(&invited)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "error",
+				"message": "Database error: " + err.Error(),
+			})
+			return
+		}
+
+		if !invited {
+			render.Status(r, http.StatusForbidden)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "This event is invite-only",
+			})
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	// Events fill up at their own capacity, or the room's when they have none.
+	// Joins wait for each other on the event's row, so that two of them
+	// cannot both take the last seat
+	if capacity.Valid {
+		var attending int
+		_, err = tx.Exec(`SELECT 1 FROM public."Events" WHERE event_id = $1 FOR UPDATE`, event_id)
+		if err == nil {
+			query = `SELECT COUNT(*) FROM public."user_event_membership" WHERE event_id = $1`
+			err = tx.QueryRow(query, event_id).Scan(&attending)
+		}
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "error",
+				"message": "Database error: " + err.Error(),
+			})
+			return
+		}
+
+		if attending >= int(capacity.Int32) {
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "This event is full",
+			})
+			return
+		}
+	}
+
 	// If not a member, insert the user into the RSO membership table
 	query = `INSERT INTO public."user_event_membership" (user_id, event_id) VALUES ($1, $2)`
-	_, err = db.Exec(query, userId, event_id)
+	_, err = tx.Exec(query, userId, event_id)
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
 		render.JSON(w, r, map[string]interface{}{
@@ -798,11 +976,35 @@ func JoinEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	render.Status(r, http.StatusAccepted)
-	render.JSON(w, r, map[string]interface{}{
+	// Joining counts as accepting a pending invitation
+	if visibility == "invite_only" {
+		query = `UPDATE public."Event_Invitations" SET status = 'accepted', date_responded = CURRENT_TIMESTAMP
+				WHERE user_id = $1 AND event_id = $2 AND status = 'pending'`
+		_, err = tx.Exec(query, userId, event_id)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	response := map[string]interface{}{
 		"status": "success",
 		"data":   "User added to the event",
-	})
+	}
+	// Attendees get the meeting link of online and hybrid events
+	if meetingURL.Valid {
+		response["meeting_url"] = meetingURL.String
+	}
+
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, response)
 }
 
 func CheckPermissions(w http.ResponseWriter, r *http.Request) {
@@ -962,19 +1164,8 @@ func LeaveEvent(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func DeleteEvent(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement the logic to delete an event
-	render.JSON(w, r, "DeleteEvent endpoint")
-}
-
-func UpdateEvent(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement the logic to update an event
-	render.JSON(w, r, "UpdateEvent endpoint")
-}
-
 // Auth token required...
-func CreateEvent(w http.ResponseWriter, r *http.Request) {
-
+func GetEvent(w http.ResponseWriter, r *http.Request) {
 	db, err := connectToDB()
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
@@ -983,169 +1174,483 @@ func CreateEvent(w http.ResponseWriter, r *http.Request) {
 	}
 	defer db.Close()
 
-	//
-	var event EventForm
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
 
-	err = json.NewDecoder(r.Body).Decode(&event)
+	eventId := chi.URLParam(r, "eventId")
 
+	tx, err := BeginUserTx(db, user)
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
 		render.JSON(w, r, map[string]interface{}{
-			"status":  "warning",
-			"message": "There was an error on the submitted form",
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
 		})
 		return
 	}
+	defer tx.Rollback()
 
-	// In case there is RSO
-	query := `SELECT r.rso_id from public."RSOs" r WHERE r.name = $1`
+	query := `SELECT e.event_id, e.name, e.description, e.start_time, e.end_time, e.time_zone, l.address, e.loc_id,
+			COALESCE(e.capacity, l.capacity), COALESCE(l.accessibility, '{}'), COALESCE(l.directions, b.directions),
+			e.visibility, e.uni_id, e.rso_id,
+			e.contact_phone, e.contact_email, e.status, e.status_reason, e.attendance_mode, e.meeting_platform, e.meeting_url
+			FROM public."Events" e
+			LEFT JOIN public."Locations" l ON l.loc_id = e.loc_id
+			LEFT JOIN public."Locations" b ON b.loc_id = l.parent_id
+			WHERE e.event_id = $2 AND ` + visibleEventClause
 
-	// Get rso_id
-	if event.RsoName != "" {
-		// Get rso_id
-		err = db.QueryRow(query, event.RsoName).Scan(&event.RsoId)
-		if err != nil {
-			render.Status(r, http.StatusInternalServerError)
+	var event EventDetail
+	var start, end time.Time
+	var zone string
+	var phone, email, meetingURL sql.NullString
+	err = tx.QueryRow(query, user.UserID, eventId).Scan(&event.EventId, &event.Name, &event.Description, &start,
+		&end, &zone, &event.Location, &event.LocId, &event.Capacity, pq.Array(&event.Accessibility), &event.Directions, &event.Visibility, &event.UniId, &event.RsoId, &phone, &email,
+		&event.Status, &event.StatusReason, &event.AttendanceMode, &event.MeetingPlatform, &meetingURL)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			render.Status(r, http.StatusNotFound)
 			render.JSON(w, r, map[string]interface{}{
 				"status":  "warning",
-				"message": "There was an error getting RSO ID",
+				"message": "Event not found",
 			})
 			return
 		}
-	}
-
-	// Now the uni_id
-	query = `SELECT u.uni_id FROM public."Universities" u WHERE u.name = $1`
-	err = db.QueryRow(query, event.UniversityName).Scan(&event.UniId)
-
-	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
 		render.JSON(w, r, map[string]interface{}{
-			"status":  "warning",
-			"message": "There was an error getting University ID " + err.Error(),
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
 		})
 		return
 	}
 
-	// Last, loc_id
-	query = `SELECT l.loc_id FROM public."Locations" l WHERE l.address = $1`
-
-	err = db.QueryRow(query, event.Location).Scan(&event.LocId)
+	event.EventTimes = newEventTimes(start, end, zone)
 
+	event.Hosts, err = getEventHosts(tx, event.EventId, true)
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
 		render.JSON(w, r, map[string]interface{}{
 			"status":  "warning",
-			"message": "There was an error getting Location ID " + err.Error(),
+			"message": "Error getting event hosts",
 		})
 		return
 	}
 
-	var insertQuery string
-	var args []interface{}
-	if event.RsoId.Int32 != 0 {
-		insertQuery = `INSERT INTO public."Events" (name, description, start_time, end_time, loc_id, uni_id, rso_id, visibility) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-		args = append(args, event.Name, event.Description, event.StartTime, event.EndTime, event.LocId, event.UniId, event.RsoId, event.Visibility)
-	} else {
-		insertQuery = `INSERT INTO public."Events" (name, description, start_time, end_time, loc_id, uni_id, visibility) VALUES ($1, $2, $3, $4, $5, $6, $7)`
-		args = append(args, event.Name, event.Description, event.StartTime, event.EndTime, event.LocId, event.UniId, event.Visibility)
-	}
-
-	_, err = db.Exec(insertQuery, args...)
-
+	showContact, err := canSeeEventContact(db, user.UserID, event.EventId)
 	if err != nil {
-		if pgerr, ok := err.(*pq.Error); ok {
-			switch pgerr.Code {
-			case "23505": // Unique violation
-				render.Status(r, http.StatusConflict)
-				render.JSON(w, r, map[string]interface{}{
-					"status":  "error",
-					"message": "An event with the same name already exists.",
-				})
-			case "P0001":
-				render.Status(r, http.StatusConflict)
-				render.JSON(w, r, map[string]interface{}{
-					"status":  "error",
-					"message": pgerr.Message,
-				})
-			default:
-				render.Status(r, http.StatusInternalServerError)
-				render.JSON(w, r, map[string]interface{}{
-					"status":  "error",
-					"message": "Internal Server Error: " + pgerr.Message,
-				})
-			}
-			return
-		}
-		// If it's not a pq.Error, handle it as an unknown error
 		render.Status(r, http.StatusInternalServerError)
 		render.JSON(w, r, map[string]interface{}{
-			"status":  "warning",
-			"message": "Unknown error occurred: " + err.Error(),
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
 		})
 		return
 	}
 
+	// The meeting link goes to the same people, others see it once they join
+	if showContact {
+		if phone.Valid {
+			event.ContactPhone = &phone.String
+		}
+		if email.Valid {
+			event.ContactEmail = &email.String
+		}
+		if meetingURL.Valid {
+			event.MeetingURL = &meetingURL.String
+		}
+	}
+
 	render.JSON(w, r, map[string]interface{}{
-		"status":  "Success",
-		"message": "Event Created",
+		"status": "success",
+		"data":   event,
 	})
 }
 
-func GetAllRSOs(w http.ResponseWriter, r *http.Request) {
-	db, err := connectToDB()
+func DeleteEvent(w http.ResponseWriter, r *http.Request) {
+	// TODO: Implement the logic to delete an event
+	render.JSON(w, r, "DeleteEvent endpoint")
+}
 
-	if err != nil {
+func UpdateEvent(w http.ResponseWriter, r *http.Request) {
+	// TODO: Implement the logic to update an event
+	render.JSON(w, r, "UpdateEvent endpoint")
+}
+
+// Auth token required...
+func CreateEvent(w http.ResponseWriter, r *http.Request) {
+
+	db, err := connectToDB()
+	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
 		render.PlainText(w, r, err.Error())
 		return
 	}
 	defer db.Close()
 
-	rows, err := db.Query(`SELECT r.name, r.description, r.date_created FROM public."RSOs" r`)
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	//
+	var event EventForm
+
+	err = json.NewDecoder(r.Body).Decode(&event)
 
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
 		render.JSON(w, r, map[string]interface{}{
 			"status":  "warning",
-			"message": "Error getting RSOs",
+			"message": "There was an error on the submitted form",
 		})
 		return
 	}
 
-	defer rows.Close()
+	start, end, err := parseEventTimes(event.StartTime, event.EndTime)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
 
-	var rsos []RsoForm
+	err = resolveEventContact(db, user.UserID, &event)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
 
-	for rows.Next() {
-		var rso RsoForm
-		err = rows.Scan(&rso.Name, &rso.Description, &rso.DateCreated)
+	// In case there is RSO
+	query := `SELECT r.rso_id, r.active from public."RSOs" r WHERE r.name = $1 AND r.archived_at IS NULL`
 
+	// Get rso_id
+	if event.RsoName != "" {
+		var active bool
+		// Get rso_id
+		err = db.QueryRow(query, event.RsoName).Scan(&event.RsoId, &active)
 		if err != nil {
 			render.Status(r, http.StatusInternalServerError)
 			render.JSON(w, r, map[string]interface{}{
 				"status":  "warning",
-				"message": "Error getting Locations array",
+				"message": "There was an error getting RSO ID",
+			})
+			return
+		}
+
+		// Only officers and the admin create events on the RSO's behalf
+		officer, err := isRSOOfficer(db, user.UserID, int(event.RsoId.Int32))
+		if err == nil && !officer {
+			officer, err = isSuperadminOfRSO(db, user, int(event.RsoId.Int32))
+		}
+		if err != nil || !officer {
+			render.Status(r, http.StatusForbidden)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Only officers of the RSO can create events for it",
+			})
+			return
+		}
+
+		if event.Visibility == "rso_event" && !active {
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "This RSO does not have enough members to host RSO events",
 			})
 			return
 		}
-		rsos = append(rsos, rso)
 	}
 
-	// If there was an error in the for, it should get here. But I think the
-	// first return should honestly take care of it in any weird case..
-	if err = rows.Err(); err != nil {
+	// Now the uni_id, and the university's time zone in case the event has none
+	var uniZone string
+	query = `SELECT u.uni_id, u.time_zone FROM public."Universities" u WHERE u.name = $1`
+	err = db.QueryRow(query, event.UniversityName).Scan(&event.UniId, &uniZone)
+
+	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
 		render.JSON(w, r, map[string]interface{}{
 			"status":  "warning",
-			"message": "Error iterating over rows",
+			"message": "There was an error getting University ID " + err.Error(),
+		})
+		return
+	}
+
+	if event.TimeZone == "" {
+		event.TimeZone = uniZone
+	}
+
+	err = validateTimeZone(event.TimeZone)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	event.Location = strings.TrimSpace(event.Location)
+	event.MeetingURL = strings.TrimSpace(event.MeetingURL)
+
+	// Older clients still name the Online location that used to stand for
+	// online events. Such an event is online now, and needs its link.
+	if strings.EqualFold(event.Location, legacyOnlineLocation) && event.VenueId == 0 {
+		if event.MeetingURL == "" {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "The Online location is gone, leave out loc_name and give the meeting_url of the online event instead",
+			})
+			return
+		}
+		event.Location = ""
+	}
+
+	mode, err := attendanceMode(event.Location != "" || event.VenueId != 0, event.MeetingURL != "")
+	if err == nil && event.MeetingURL != "" {
+		event.MeetingPlatform, err = validateMeeting(event.MeetingURL, event.MeetingPlatform)
+	}
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// Last, loc_id. An id picks the room directly, an address only when no
+	// other room shares it. Addresses are compared normalised.
+	var roomCapacity sql.NullInt32
+	if event.VenueId != 0 || event.Location != "" {
+		matches := 1
+		if event.VenueId != 0 {
+			query = `SELECT l.loc_id, l.capacity FROM public."Locations" l WHERE l.loc_id = $1`
+			err = db.QueryRow(query, event.VenueId).Scan(&event.LocId, &roomCapacity)
+		} else {
+			query = `SELECT l.loc_id, l.capacity, COUNT(*) OVER () FROM public."Locations" l
+					WHERE l.normalized_address = public.normalize_address($1) LIMIT 1`
+			err = db.QueryRow(query, event.Location).Scan(&event.LocId, &roomCapacity, &matches)
+		}
+
+		if err == sql.ErrNoRows {
+			response := map[string]interface{}{
+				"status":  "warning",
+				"message": "Location not found",
+			}
+			// Places with a similar name the organiser may have meant
+			if event.Location != "" {
+				suggestions, err := findSimilarLocations(db, Location{Address: event.Location}, 0, true)
+				if err == nil && len(suggestions) > 0 {
+					response["suggestions"] = suggestions
+				}
+			}
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, response)
+			return
+		}
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "There was an error getting Location ID " + err.Error(),
+			})
+			return
+		}
+		if matches > 1 {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Several rooms are called " + event.Location + ", pick one by loc_id",
+			})
+			return
+		}
+	}
+
+	if event.Capacity != nil {
+		err = nil
+		switch {
+		case *event.Capacity <= 0:
+			err = fmt.Errorf("capacity must be a positive number")
+		case roomCapacity.Valid && *event.Capacity > int(roomCapacity.Int32):
+			err = fmt.Errorf("capacity cannot be more than the %d people the room holds", roomCapacity.Int32)
+		}
+		if err != nil {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	var insertQuery string
+	var args []interface{}
+	if event.RsoId.Int32 != 0 {
+		insertQuery = `INSERT INTO public."Events" (name, description, start_time, end_time, time_zone, loc_id, uni_id, rso_id, visibility, created_by, contact_phone, contact_email, attendance_mode, meeting_platform, meeting_url, capacity) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), NULLIF($12, ''), $13, NULLIF($14, '')::public.meeting_platform, NULLIF($15, ''), $16) RETURNING event_id`
+		args = append(args, event.Name, event.Description, start, end, event.TimeZone, event.LocId, event.UniId, event.RsoId, event.Visibility, user.UserID, event.ContactPhone, event.ContactEmail, mode, event.MeetingPlatform, event.MeetingURL, event.Capacity)
+	} else {
+		insertQuery = `INSERT INTO public."Events" (name, description, start_time, end_time, time_zone, loc_id, uni_id, visibility, created_by, contact_phone, contact_email, attendance_mode, meeting_platform, meeting_url, capacity) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), NULLIF($11, ''), $12, NULLIF($13, '')::public.meeting_platform, NULLIF($14, ''), $15) RETURNING event_id`
+		args = append(args, event.Name, event.Description, start, end, event.TimeZone, event.LocId, event.UniId, event.Visibility, user.UserID, event.ContactPhone, event.ContactEmail, mode, event.MeetingPlatform, event.MeetingURL, event.Capacity)
+	}
+
+	// The event and its hosts are recorded together or not at all
+	tx, err := db.Begin()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var eventId int
+	err = tx.QueryRow(insertQuery, args...).Scan(&eventId)
+
+	if err != nil {
+		if pgerr, ok := err.(*pq.Error); ok {
+			switch pgerr.Code {
+			case "23505": // Unique violation
+				render.Status(r, http.StatusConflict)
+				render.JSON(w, r, map[string]interface{}{
+					"status":  "error",
+					"message": "An event with the same name already exists.",
+				})
+			case "P0001":
+				render.Status(r, http.StatusConflict)
+				render.JSON(w, r, map[string]interface{}{
+					"status":  "error",
+					"message": pgerr.Message,
+				})
+			case "23514": // Check violation, e.g. event_place
+				render.Status(r, http.StatusBadRequest)
+				render.JSON(w, r, map[string]interface{}{
+					"status":  "error",
+					"message": "The event breaks the rule " + pgerr.Constraint,
+				})
+			default:
+				render.Status(r, http.StatusInternalServerError)
+				render.JSON(w, r, map[string]interface{}{
+					"status":  "error",
+					"message": "Internal Server Error: " + pgerr.Message,
+				})
+			}
+			return
+		}
+		// If it's not a pq.Error, handle it as an unknown error
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Unknown error occurred: " + err.Error(),
+		})
+		return
+	}
+
+	// The creating RSO is always the first accepted host
+	if event.RsoId.Int32 != 0 {
+		query = `INSERT INTO public."Event_Hosts" (event_id, rso_id, status) VALUES ($1, $2, 'accepted')`
+		_, err = tx.Exec(query, eventId, event.RsoId)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "The event could not be created: " + err.Error(),
 		})
 		return
 	}
 
 	render.JSON(w, r, map[string]interface{}{
-		"status": "success",
-		"data":   rsos,
+		"status":   "Success",
+		"message":  "Event Created",
+		"event_id": eventId,
+	})
+}
+
+// Auth token required...
+// RSOs of the user's university. ?q= searches names and descriptions,
+// ?category= (repeatable) filters, ?sort= is name, size, activity or newest.
+func GetAllRSOs(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	err = validateCategories(r.URL.Query()["category"])
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	tx, err := BeginUserTx(db, user)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	rsos, err := searchRSOs(tx, r, user.UniId)
+
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting RSOs: " + err.Error(),
+		})
+		return
+	}
+
+	page, perPage := parsePage(r)
+	render.JSON(w, r, map[string]interface{}{
+		"status":   "success",
+		"data":     rsos,
+		"page":     page,
+		"per_page": perPage,
 	})
 }
 
@@ -1178,7 +1683,7 @@ func GetUserRSOs(w http.ResponseWriter, r *http.Request) {
 						FROM public."RSOs" r 
 						left join public."User_RSO_Membership" urm 
 						on 
-						r.rso_id = urm.rso_id where urm.user_id = $1`, user_id)
+						r.rso_id = urm.rso_id where urm.user_id = $1 and r.archived_at is null`, user_id)
 
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
@@ -1225,6 +1730,9 @@ func GetUserRSOs(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// Auth token required...
+// The user leaves the RSO given in the path, or named by rso_name in the
+// body. Officers remove others through RemoveRSOMember.
 func LeaveRSO(w http.ResponseWriter, r *http.Request) {
 	db, err := connectToDB()
 
@@ -1238,60 +1746,72 @@ func LeaveRSO(w http.ResponseWriter, r *http.Request) {
 	}
 	defer db.Close()
 
-	var rsoLeave RsoJoin
-
-	err = json.NewDecoder(r.Body).Decode(&rsoLeave)
-
+	// Only ever the logged in user, never whoever the body names
+	user, err := currentUser(db, r)
 	if err != nil {
-		render.Status(r, http.StatusInternalServerError)
+		render.Status(r, http.StatusUnauthorized)
 		render.JSON(w, r, map[string]interface{}{
 			"status":  "warning",
-			"message": "There was an error parsing the data",
+			"message": "Could not identify the user",
 		})
 		return
 	}
+	userId := user.UserID
 
-	// get event_id
-	var rso_id string
-	query := `SELECT rso_id FROM public."RSOs" WHERE name = $1`
-	err = db.QueryRow(query, rsoLeave.RsoName).Scan(&rso_id)
-
-	if err != nil {
-		render.Status(r, http.StatusInternalServerError)
-		render.JSON(w, r, map[string]interface{}{
-			"status":  "warning",
-			"message": "There was an error getting the RSO ID",
-		})
-		return
-	}
+	var rso_id int
+	if param := chi.URLParam(r, "rsoId"); param != "" {
+		rso_id, err = strconv.Atoi(param)
+		if err != nil {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Invalid RSO ID",
+			})
+			return
+		}
+	} else {
+		var rsoLeave RsoJoin
 
-	var userId int
+		err = json.NewDecoder(r.Body).Decode(&rsoLeave)
 
-	// Get the userid off the username
-	query = `SELECT user_id FROM public."Users" WHERE username = $1`
-	err = db.QueryRow(query, rsoLeave.Username).Scan(&userId)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			render.Status(r, http.StatusNotFound)
+		if err != nil {
+			render.Status(r, http.StatusBadRequest)
 			render.JSON(w, r, map[string]interface{}{
-				// This should never ever happen. But added just as precaution
 				"status":  "warning",
-				"message": "User not found",
+				"message": "There was an error parsing the data",
 			})
 			return
-		} else {
-			render.Status(r, http.StatusInternalServerError)
+		}
+
+		query := `SELECT rso_id FROM public."RSOs" WHERE name = $1`
+		err = db.QueryRow(query, rsoLeave.RsoName).Scan(&rso_id)
+
+		if err != nil {
+			render.Status(r, http.StatusNotFound)
 			render.JSON(w, r, map[string]interface{}{
-				"status":  "error",
-				"message": "Database error: " + err.Error(),
+				"status":  "warning",
+				"message": "RSO not found",
 			})
 			return
 		}
 	}
 
-	// If not a member, insert the user into the user event membership table
-	query = `DELETE FROM public."User_RSO_Membership" WHERE user_id = $1 AND rso_id = $2`
-	_, err = db.Exec(query, userId, rso_id)
+	// The admin has to hand the RSO over before leaving it
+	role, err := rsoRole(db, userId, rso_id)
+	if err == nil && role == "admin" {
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Transfer the RSO to another member before leaving it",
+		})
+		return
+	}
+
+	query := `DELETE FROM public."User_RSO_Membership" WHERE user_id = $1 AND rso_id = $2`
+	err = changeMembership(db, rso_id, func(tx *sql.Tx) error {
+		_, err := tx.Exec(query, userId, rso_id)
+		return err
+	})
 
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
@@ -1309,22 +1829,10 @@ func LeaveRSO(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func GetRSO(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement the logic to get an RSO
-	render.JSON(w, r, "GetRSO endpoint")
-}
-
-func DeleteRSO(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement the logic to delete an RSO
-	render.JSON(w, r, "DeleteRSO endpoint")
-}
-
-func UpdateRSO(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement the logic to update an RSO
-	render.JSON(w, r, "UpdateRSO endpoint")
-}
-
-func CreateRSO(w http.ResponseWriter, r *http.Request) {
+// Auth token required...
+// Organisers check a user in at the event. Users who did not RSVP are added
+// as walk-ins.
+func AttendEvent(w http.ResponseWriter, r *http.Request) {
 	db, err := connectToDB()
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
@@ -1333,78 +1841,86 @@ func CreateRSO(w http.ResponseWriter, r *http.Request) {
 	}
 	defer db.Close()
 
-	decoder := json.NewDecoder(r.Body)
-	var rsoForm RsoForm
-	err = decoder.Decode(&rsoForm)
+	user, err := currentUser(db, r)
 	if err != nil {
-		render.Status(r, http.StatusInternalServerError)
+		render.Status(r, http.StatusUnauthorized)
 		render.JSON(w, r, map[string]interface{}{
-			"status":  "Error",
-			"message": "Error parsing form data " + err.Error(),
+			"status":  "warning",
+			"message": "Could not identify the user",
 		})
 		return
 	}
 
-	// Get the user details based on promotion value
-	usernames := map[string]string{"1": rsoForm.Sone, "2": rsoForm.Stwo, "3": rsoForm.Sthree, "4": rsoForm.Sfour}
-	username, exists := usernames[rsoForm.PromotionUser]
-	if !exists {
+	eventId, err := strconv.Atoi(chi.URLParam(r, "eventId"))
+	if err != nil {
 		render.Status(r, http.StatusBadRequest)
 		render.JSON(w, r, map[string]interface{}{
-			"status":  "Error",
-			"message": "Invalid promotion user selection",
+			"status":  "warning",
+			"message": "Invalid event ID",
+		})
+		return
+	}
+
+	organiser, err := isEventOrganiser(db, user.UserID, eventId)
+	if err != nil || !organiser {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Only the organisers of the event can check people in",
 		})
 		return
 	}
 
-	query := `SELECT user_id, uni_id, email FROM public."Users" WHERE username = $1`
-	err = db.QueryRow(query, username).Scan(&rsoForm.AdminId, &rsoForm.UniId, &rsoForm.StudentEmail)
+	// Check-in opens when the event starts and closes once it is cancelled or completed
+	var open bool
+	query := `SELECT status IN ('scheduled', 'postponed') AND start_time <= CURRENT_TIMESTAMP FROM public."Events" WHERE event_id = $1`
+	err = db.QueryRow(query, eventId).Scan(&open)
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
 		render.JSON(w, r, map[string]interface{}{
-			"status":  "Error",
-			"message": "Error fetching user details " + err.Error(),
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if !open {
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Check-in is only open for scheduled or postponed events that have started",
 		})
 		return
 	}
 
-	// Create RSO record
-	query = `INSERT INTO public."RSOs" (name, description, uni_id, admin_id, date_created)
-			 VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP) RETURNING rso_id;`
-	err = db.QueryRow(query, rsoForm.Name, rsoForm.Description, rsoForm.UniId, rsoForm.AdminId).Scan(&rsoForm.RsoId)
+	query = `INSERT INTO public.user_event_membership (user_id, event_id, checked_in_at)
+			SELECT user_id, $2, CURRENT_TIMESTAMP FROM public."Users" WHERE username = $1
+			ON CONFLICT (user_id, event_id) DO UPDATE SET checked_in_at = COALESCE(user_event_membership.checked_in_at, CURRENT_TIMESTAMP)`
+	result, err := db.Exec(query, chi.URLParam(r, "username"), eventId)
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
 		render.JSON(w, r, map[string]interface{}{
-			"status":  "Error",
-			"message": "Failed to create RSO " + err.Error(),
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
 		})
 		return
 	}
 
-	// Add all users to the membership table
-	usernamesToInsert := []string{rsoForm.Sone, rsoForm.Stwo, rsoForm.Sthree, rsoForm.Sfour}
-	for _, uname := range usernamesToInsert {
-		query = `INSERT INTO public."User_RSO_Membership" (user_id, rso_id)
-				 SELECT user_id, $1 FROM public."Users" WHERE username = $2;`
-		_, err = db.Exec(query, rsoForm.RsoId, uname)
-		if err != nil {
-			render.Status(r, http.StatusInternalServerError)
-			render.PlainText(w, r, "Error adding user to RSO: "+err.Error())
-			return
-		}
+	if n, _ := result.RowsAffected(); n == 0 {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "User not found",
+		})
+		return
 	}
 
 	render.JSON(w, r, map[string]interface{}{
-		"status":  "Success",
-		"message": "RSO created successfully and users added.",
+		"status":  "success",
+		"message": "User checked in",
 	})
 }
 
-func AttendEvent(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement the logic to add user to event list
-	render.JSON(w, r, "AttendEvent endpoint")
-}
-
 func UnattendEvent(w http.ResponseWriter, r *http.Request) {
 	// TODO: Implement the logic to remove user from event list
 	render.JSON(w, r, "UnattendEvent endpoint")
@@ -1612,6 +2128,17 @@ func JoinRSO(w http.ResponseWriter, r *http.Request) {
 	}
 	defer db.Close()
 
+	// Joins are for the logged in user only
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
 	var rsoJoin RsoJoin
 
 	err = json.NewDecoder(r.Body).Decode(&rsoJoin)
@@ -1626,9 +2153,10 @@ func JoinRSO(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// get rso_id
-	var rso_id string
-	query := `SELECT rso_id FROM public."RSOs" WHERE name = $1`
-	err = db.QueryRow(query, rsoJoin.RsoName).Scan(&rso_id)
+	var rso_id, uni_id int
+	var policy string
+	query := `SELECT rso_id, uni_id, join_policy FROM public."RSOs" WHERE name = $1 AND archived_at IS NULL`
+	err = db.QueryRow(query, rsoJoin.RsoName).Scan(&rso_id, &uni_id, &policy)
 
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
@@ -1639,34 +2167,19 @@ func JoinRSO(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var userId int
-
-	// Get the userid off the username
-	query = `SELECT user_id FROM public."Users" WHERE username = $1`
-	err = db.QueryRow(query, rsoJoin.Username).Scan(&userId)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			render.Status(r, http.StatusNotFound)
-			render.JSON(w, r, map[string]interface{}{
-				// This should never ever happen. But added just as precaution
-				"status":  "warning",
-				"message": "User not found",
-			})
-			return
-		} else {
-			render.Status(r, http.StatusInternalServerError)
-			render.JSON(w, r, map[string]interface{}{
-				"status":  "error",
-				"message": "Database error: " + err.Error(),
-			})
-			return
-		}
+	if uni_id != user.UniId {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Only students of the RSO's university can join it",
+		})
+		return
 	}
 
 	// Check if the user is already a member of the RSO
 	var exists bool
 	query = `SELECT EXISTS(SELECT 1 FROM public."User_RSO_Membership" WHERE user_id = $1 AND rso_id = $2)`
-	err = db.QueryRow(query, userId, rso_id).Scan(&exists)
+	err = db.QueryRow(query, user.UserID, rso_id).Scan(&exists)
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
 		render.JSON(w, r, map[string]interface{}{
@@ -1684,9 +2197,53 @@ func JoinRSO(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// If not a member, insert the user into the RSO membership table
-	query = `INSERT INTO public."User_RSO_Membership" (user_id, rso_id) VALUES ($1, $2)`
-	_, err = db.Exec(query, userId, rso_id)
+	// An invitation from an officer lets the user in whatever the policy
+	inviteId, err := pendingRSOInvite(db, rso_id, user.UserID)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if inviteId == 0 && policy == "invite_only" {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "This RSO only takes members it invites",
+		})
+		return
+	}
+
+	if inviteId == 0 && policy == "approval" {
+		err = requestToJoinRSO(db, rso_id, user.UserID, rsoJoin.Message)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Error sending the join request: " + err.Error(),
+			})
+			return
+		}
+
+		body := user.UserName + " asked to join " + rsoJoin.RsoName + "."
+		if message := strings.TrimSpace(rsoJoin.Message); message != "" {
+			body += "\n\n" + message
+		}
+		notifyOfficers(r, db, rso_id, "Request to join "+rsoJoin.RsoName, body)
+
+		render.Status(r, http.StatusAccepted)
+		render.JSON(w, r, map[string]interface{}{
+			"status": "success",
+			"data":   "Join request sent, an officer of the RSO will review it",
+		})
+		return
+	}
+
+	// Otherwise insert the user into the RSO membership table
+	err = addRSOMember(db, rso_id, user.UserID, inviteId, sql.NullInt32{})
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
 		render.JSON(w, r, map[string]interface{}{
@@ -1713,7 +2270,9 @@ func GetAllUnis(w http.ResponseWriter, r *http.Request) {
 	}
 	defer db.Close()
 
-	rows, err := db.Query(`SELECT u.name, u.description, u.student_no FROM public."Universities" u`)
+	rows, err := db.Query(`SELECT u.uni_id, u.name, u.description, u.student_no, u.time_zone, u.email_domains,
+		u.latitude, u.longitude, u.picture_id
+		FROM public."Universities" u WHERE u.archived_at IS NULL ORDER BY u.name`)
 
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
@@ -1730,7 +2289,10 @@ func GetAllUnis(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var uni University
-		err = rows.Scan(&uni.Name, &uni.Description, &uni.StudentNo)
+		var picture sql.NullInt32
+		err = rows.Scan(&uni.UniId, &uni.Name, &uni.Description, &uni.StudentNo, &uni.TimeZone, pq.Array(&uni.EmailDomains),
+			&uni.Latitude, &uni.Longitude, &picture)
+		uni.PictureURL = mediaURL(picture)
 
 		if err != nil {
 			render.Status(r, http.StatusInternalServerError)
@@ -1773,12 +2335,24 @@ func GetAllUnis(w http.ResponseWriter, r *http.Request) {
 
 // }
 
-func UpdateUniDetails(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement the logic to update the details of a specific university
-	render.JSON(w, r, "UpdateUniDetails endpoint")
-}
-
 func GetAllLocations(w http.ResponseWriter, r *http.Request) {
+	// ?lat=&lng=&radius= narrows the list down to the places around a point
+	if r.URL.Query().Has("lat") || r.URL.Query().Has("lng") {
+		GetLocations(w, r)
+		return
+	}
+
+	// ?accessibility= keeps the places with those features
+	features, err := parseAccessibilityFilter(r)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	db, err := connectToDB()
 
 	if err != nil {
@@ -1788,7 +2362,8 @@ func GetAllLocations(w http.ResponseWriter, r *http.Request) {
 	}
 	defer db.Close()
 
-	rows, err := db.Query(`SELECT l.address, l.latitude, l.longitude FROM public."Locations" l`)
+	rows, err := db.Query(`SELECT `+locationColumns+` FROM public."Locations" l WHERE `+accessibleClause("$1")+` ORDER BY l.loc_id`,
+		pq.Array(features))
 
 	if err != nil {
 		render.Status(r, http.StatusInternalServerError)
@@ -1805,7 +2380,7 @@ func GetAllLocations(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var location Location
-		err = rows.Scan(&location.Address, &location.Latitude, &location.Longitude)
+		err = rows.Scan(locationFields(&location)...)
 
 		if err != nil {
 			render.Status(r, http.StatusInternalServerError)
@@ -1844,21 +2419,81 @@ func CreateLocation(w http.ResponseWriter, r *http.Request) {
 	}
 	defer db.Close()
 
-	var location Location
+	var form LocationForm
 
-	err = json.NewDecoder(r.Body).Decode(&location)
+	err = json.NewDecoder(r.Body).Decode(&form)
 
 	if err != nil {
 		render.Status(r, http.StatusBadRequest)
 		render.PlainText(w, r, err.Error())
 		return
 	}
+	location := form.Location
 
-	// Check if location exists before creating
+	err = validateCoordinates(location.Latitude, location.Longitude)
+	if err == nil {
+		err = validateVenue(location.Capacity, location.Accessibility)
+	}
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+	if location.Accessibility == nil {
+		location.Accessibility = []string{}
+	}
+
+	// A room goes into a building, and takes its position unless it has one
+	if location.ParentId != nil {
+		var grandparent sql.NullInt32
+		var latitude, longitude *float64
+		query := `SELECT parent_id, latitude, longitude FROM public."Locations" WHERE loc_id = $1`
+		err = db.QueryRow(query, *location.ParentId).Scan(&grandparent, &latitude, &longitude)
+		if err != nil {
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Building not found",
+			})
+			return
+		}
+		if grandparent.Valid {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Rooms cannot contain other rooms",
+			})
+			return
+		}
+		if location.Latitude == nil {
+			location.Latitude, location.Longitude = latitude, longitude
+		}
+	}
+
+	// Buildings given without coordinates take them from the gazetteer when
+	// the address matches one of its places well
+	geocoded := false
+	if location.ParentId == nil && location.Latitude == nil && location.Address != "" {
+		place, err := geocodeAddress(r.Context(), form.UniId, location.Address)
+		if err != nil {
+			log.Printf("Error geocoding %q: %v", location.Address, err)
+		}
+		if place != nil {
+			location.Latitude, location.Longitude = &place.Latitude, &place.Longitude
+			geocoded = true
+		}
+	}
+
+	// Check if location exists before creating, however it is spelled. Rooms
+	// only need a name that is unique within their building.
 	var locationCount int
-	checkUserQuery := `SELECT COUNT(*) FROM public."Locations" WHERE address = $1`
+	checkUserQuery := `SELECT COUNT(*) FROM public."Locations"
+			WHERE normalized_address = public.normalize_address($1) AND parent_id IS NOT DISTINCT FROM $2`
 
-	err = db.QueryRow(checkUserQuery, location.Address).Scan(&locationCount)
+	err = db.QueryRow(checkUserQuery, location.Address, location.ParentId).Scan(&locationCount)
 
 	switch {
 	case err != nil:
@@ -1870,7 +2505,7 @@ func CreateLocation(w http.ResponseWriter, r *http.Request) {
 		return
 
 	case locationCount > 0:
-		render.Status(r, http.StatusInternalServerError)
+		render.Status(r, http.StatusConflict)
 
 		render.JSON(w, r, map[string]interface{}{
 			"Error":   "Error",
@@ -1879,10 +2514,34 @@ func CreateLocation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := `INSERT INTO public."Locations" (address, latitude, longitude)
-											VALUES ($1, $2, $3);`
+	// Likely duplicates are suggested instead, ?force=true creates it anyway
+	if r.URL.Query().Get("force") != "true" {
+		matches, err := findSimilarLocations(db, location, 0, false)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"Error":   "Error",
+				"message": "Error looking for duplicates " + err.Error(),
+			})
+			return
+		}
+
+		if len(matches) > 0 {
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, map[string]interface{}{
+				"Error":       "Error",
+				"message":     "Similar locations already exist, use one of them or repeat with ?force=true",
+				"suggestions": matches,
+			})
+			return
+		}
+	}
+
+	query := `INSERT INTO public."Locations" (address, latitude, longitude, parent_id, capacity, accessibility, directions)
+											VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')) RETURNING loc_id;`
 
-	_, err = db.Exec(query, location.Address, location.Latitude, location.Longitude)
+	err = db.QueryRow(query, location.Address, location.Latitude, location.Longitude, location.ParentId,
+		location.Capacity, pq.Array(location.Accessibility), location.Directions).Scan(&location.LocId)
 
 	if err != nil {
 		render.Status(r, http.StatusNotFound)
@@ -1894,12 +2553,10 @@ func CreateLocation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	render.JSON(w, r, map[string]interface{}{
-		"status":  "Success",
-		"message": "Event Created",
+		"status":   "Success",
+		"message":  "Location Created",
+		"data":     location,
+		"geocoded": geocoded,
 	})
 
 }
-func GetLocations(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement the logic to get all the locations of a user in a given radius
-	render.JSON(w, r, "GetLocations endpoint")
-}
@@ -0,0 +1,568 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+const (
+	defaultInviteLinkTTL = 72 * time.Hour
+	maxInviteLinkTTL     = 30 * 24 * time.Hour
+)
+
+var errBadInviteToken = errors.New("invalid invitation link")
+var errExpiredInviteToken = errors.New("invitation link has expired")
+
+type InvitationForm struct {
+	Usernames []string `json:"usernames"`
+}
+
+type InvitationLinkForm struct {
+	ExpiresInHours int `json:"expires_in_hours"`
+}
+
+type InvitationResponse struct {
+	Accept bool `json:"accept"`
+}
+
+type InvitationRedeem struct {
+	Token  string `json:"token"`
+	Accept bool   `json:"accept"`
+}
+
+type Invitation struct {
+	EventId     int            `json:"event_id"`
+	EventName   string         `json:"event_name"`
+	Username    string         `json:"username"`
+	InvitedBy   sql.NullString `json:"invited_by"`
+	Status      string         `json:"status"`
+	ViaLink     bool           `json:"via_link"`
+	DateInvited string         `json:"date_invited"`
+}
+
+// Whether the user created the event, is an officer of its RSO or administers
+// one of its host RSOs
+func isEventOrganiser(db *sql.DB, userId int, eventId int) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM public."Events" e WHERE e.event_id = $1 AND (e.created_by = $2 OR
+			e.rso_id IN (SELECT rso_id FROM public."User_RSO_Membership" WHERE user_id = $2 AND role IN ('officer', 'admin'))))`
+	err := db.QueryRow(query, eventId, userId).Scan(&exists)
+	if err != nil || exists {
+		return exists, err
+	}
+
+	return isEventHostAdmin(db, userId, eventId)
+}
+
+// Signs with a key of its own, derived from SECRET_KEY, so that no signature
+// made for a link is good for a login JWT or the other way round
+func invitationMAC(payload string) []byte {
+	key := hmac.New(sha256.New, []byte(os.Getenv("SECRET_KEY")))
+	key.Write([]byte("invitation link"))
+
+	mac := hmac.New(sha256.New, key.Sum(nil))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// Links are "<event_id>.<expiry>.<signature>"
+func signInvitation(eventId int, expires time.Time) string {
+	payload := fmt.Sprintf("%d.%d", eventId, expires.Unix())
+	return payload + "." + base64.RawURLEncoding.EncodeToString(invitationMAC(payload))
+}
+
+func verifyInvitation(token string) (int, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, errBadInviteToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, errBadInviteToken
+	}
+
+	if !hmac.Equal(signature, invitationMAC(parts[0]+"."+parts[1])) {
+		return 0, errBadInviteToken
+	}
+
+	eventId, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, errBadInviteToken
+	}
+
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, errBadInviteToken
+	}
+
+	if time.Now().Unix() > expires {
+		return 0, errExpiredInviteToken
+	}
+
+	return eventId, nil
+}
+
+// Checks the caller organises the invite-only event in the URL. Writes the
+// error response itself and returns false when the request should stop.
+func checkInviteOrganiser(db *sql.DB, w http.ResponseWriter, r *http.Request, user SessionUser) (int, bool) {
+	eventId, err := strconv.Atoi(chi.URLParam(r, "eventId"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid event ID",
+		})
+		return 0, false
+	}
+
+	var visibility string
+	err = db.QueryRow(`SELECT visibility FROM public."Events" WHERE event_id = $1`, eventId).Scan(&visibility)
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Event not found",
+		})
+		return 0, false
+	}
+
+	if visibility != "invite_only" {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invitations are only used for invite-only events",
+		})
+		return 0, false
+	}
+
+	organiser, err := isEventOrganiser(db, user.UserID, eventId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return 0, false
+	}
+
+	if !organiser {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Only the organisers of the event can manage invitations",
+		})
+		return 0, false
+	}
+
+	return eventId, true
+}
+
+// Auth token required...
+func InviteToEvent(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	eventId, ok := checkInviteOrganiser(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	var form InvitationForm
+	err = json.NewDecoder(r.Body).Decode(&form)
+	if err != nil || len(form.Usernames) == 0 {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "A list of usernames is required",
+		})
+		return
+	}
+
+	// Declined invitations are reopened when someone is invited again
+	query := `INSERT INTO public."Event_Invitations" (event_id, user_id, invited_by)
+			SELECT $1, user_id, $2 FROM public."Users" WHERE username = $3
+			ON CONFLICT (event_id, user_id) DO UPDATE
+			SET status = 'pending', invited_by = EXCLUDED.invited_by, date_invited = CURRENT_TIMESTAMP, date_responded = NULL
+			WHERE "Event_Invitations".status = 'declined'`
+
+	invited := []string{}
+	skipped := []string{}
+
+	for _, username := range form.Usernames {
+		result, err := db.Exec(query, eventId, user.UserID, username)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Error inviting " + username + ": " + err.Error(),
+			})
+			return
+		}
+
+		if n, _ := result.RowsAffected(); n == 0 {
+			skipped = append(skipped, username)
+		} else {
+			invited = append(invited, username)
+		}
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data": map[string]interface{}{
+			"invited": invited,
+			// Unknown usernames or users that already have an open invitation
+			"skipped": skipped,
+		},
+	})
+}
+
+// Auth token required...
+func CreateInvitationLink(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	eventId, ok := checkInviteOrganiser(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	// The body is optional, without it the link lasts the default time
+	var form InvitationLinkForm
+	_ = json.NewDecoder(r.Body).Decode(&form)
+
+	ttl := defaultInviteLinkTTL
+	if form.ExpiresInHours > 0 {
+		ttl = time.Duration(form.ExpiresInHours) * time.Hour
+	}
+	if ttl > maxInviteLinkTTL {
+		ttl = maxInviteLinkTTL
+	}
+
+	expires := time.Now().Add(ttl)
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data": map[string]interface{}{
+			"token":      signInvitation(eventId, expires),
+			"expires_at": expires.UTC().Format(time.RFC3339),
+		},
+	})
+}
+
+// Auth token required...
+// Organisers see who was invited and how they answered
+func GetEventInvitations(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	eventId, ok := checkInviteOrganiser(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	query := `SELECT i.event_id, e.name, u.username, inviter.username, i.status, i.via_link, i.date_invited
+			FROM public."Event_Invitations" i
+			JOIN public."Events" e ON e.event_id = i.event_id
+			JOIN public."Users" u ON u.user_id = i.user_id
+			LEFT JOIN public."Users" inviter ON inviter.user_id = i.invited_by
+			WHERE i.event_id = $1
+			ORDER BY i.date_invited`
+
+	invitations, err := queryInvitations(db, query, eventId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting invitations",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data":   invitations,
+	})
+}
+
+// Auth token required...
+// Every invitation the user has received
+func GetUserInvitations(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	query := `SELECT i.event_id, e.name, u.username, inviter.username, i.status, i.via_link, i.date_invited
+			FROM public."Event_Invitations" i
+			JOIN public."Events" e ON e.event_id = i.event_id
+			JOIN public."Users" u ON u.user_id = i.user_id
+			LEFT JOIN public."Users" inviter ON inviter.user_id = i.invited_by
+			WHERE i.user_id = $1
+			ORDER BY i.date_invited DESC`
+
+	invitations, err := queryInvitations(db, query, user.UserID)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting invitations",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data":   invitations,
+	})
+}
+
+func queryInvitations(db *sql.DB, query string, args ...interface{}) ([]Invitation, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		var invitation Invitation
+		err = rows.Scan(&invitation.EventId, &invitation.EventName, &invitation.Username, &invitation.InvitedBy,
+			&invitation.Status, &invitation.ViaLink, &invitation.DateInvited)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	return invitations, rows.Err()
+}
+
+// Auth token required...
+// Accept or decline a direct invitation
+func RespondInvitation(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	eventId, err := strconv.Atoi(chi.URLParam(r, "eventId"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid event ID",
+		})
+		return
+	}
+
+	var response InvitationResponse
+	err = json.NewDecoder(r.Body).Decode(&response)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "There was an error parsing the data",
+		})
+		return
+	}
+
+	status := "declined"
+	if response.Accept {
+		status = "accepted"
+	}
+
+	query := `UPDATE public."Event_Invitations" SET status = $1, date_responded = CURRENT_TIMESTAMP
+			WHERE event_id = $2 AND user_id = $3`
+	result, err := db.Exec(query, status, eventId, user.UserID)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "You were not invited to this event",
+		})
+		return
+	}
+
+	// Declining also takes the user off the attendee list
+	if !response.Accept {
+		query = `DELETE FROM public."user_event_membership" WHERE event_id = $1 AND user_id = $2`
+		_, err = db.Exec(query, eventId, user.UserID)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Error deleting user from event " + err.Error(),
+			})
+			return
+		}
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "Invitation " + status,
+	})
+}
+
+// Auth token required...
+// Accept or decline through a shared invitation link
+func RedeemInvitationLink(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	var redeem InvitationRedeem
+	err = json.NewDecoder(r.Body).Decode(&redeem)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "There was an error parsing the data",
+		})
+		return
+	}
+
+	eventId, err := verifyInvitation(redeem.Token)
+	if err != nil {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	status := "declined"
+	if redeem.Accept {
+		status = "accepted"
+	}
+
+	query := `INSERT INTO public."Event_Invitations" (event_id, user_id, status, via_link, date_responded)
+			VALUES ($1, $2, $3, true, CURRENT_TIMESTAMP)
+			ON CONFLICT (event_id, user_id) DO UPDATE
+			SET status = EXCLUDED.status, date_responded = EXCLUDED.date_responded`
+	_, err = db.Exec(query, eventId, user.UserID, status)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":   "success",
+		"message":  "Invitation " + status,
+		"event_id": eventId,
+	})
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/jwtauth"
+)
+
+func TestVerifyInvitation(t *testing.T) {
+	t.Setenv("SECRET_KEY", "test secret")
+	future := time.Now().Add(time.Hour)
+
+	// Signed the way a JWT is, straight with SECRET_KEY
+	payload := fmt.Sprintf("7.%d", future.Unix())
+	mac := hmac.New(sha256.New, []byte("test secret"))
+	mac.Write([]byte(payload))
+	withLoginKey := payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	_, jwt, err := jwtauth.New("HS256", []byte("test secret"), nil).Encode(map[string]interface{}{"username": "7"})
+	if err != nil {
+		t.Fatalf("encoding the token: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		want    int
+		wantErr error
+	}{
+		{"valid", signInvitation(7, future), 7, nil},
+		{"expired", signInvitation(7, time.Now().Add(-time.Minute)), 0, errExpiredInviteToken},
+		{"other event", "8" + signInvitation(7, future)[1:], 0, errBadInviteToken},
+		{"login key", withLoginKey, 0, errBadInviteToken},
+		{"login JWT", jwt, 0, errBadInviteToken},
+		{"garbage", "not a token", 0, errBadInviteToken},
+	}
+
+	for _, tt := range tests {
+		got, err := verifyInvitation(tt.token)
+		if err != tt.wantErr || got != tt.want {
+			t.Errorf("%s: got %d, %v, want %d, %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// Ids that are not numbers are refused before they reach the database
+func TestRespondInvitationBadEventId(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+
+	router := chi.NewRouter()
+	router.Put("/{eventId}/invitations", RespondInvitation)
+
+	r := asUser(t, httptest.NewRequest(http.MethodPut, "/abc/invitations", strings.NewReader(`{"accept": true}`)), f.student.UserName)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+}
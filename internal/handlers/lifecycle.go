@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/bingKegeta/Knight-Link/internal/notify"
+)
+
+// Statuses an event can move to from each status. Cancelled and completed
+// events are final, and only events that have ended can be completed.
+var eventTransitions = map[string][]string{
+	"scheduled": {"postponed", "cancelled", "completed"},
+	"postponed": {"scheduled", "cancelled", "completed"},
+}
+
+var errInvalidTransition = errors.New("invalid status change")
+
+type EventStatusForm struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+	// Required when a postponed event is scheduled again
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+}
+
+type EventStatusChange struct {
+	OldStatus string         `json:"old_status"`
+	NewStatus string         `json:"new_status"`
+	Reason    sql.NullString `json:"reason"`
+	ChangedBy sql.NullString `json:"changed_by"`
+	ChangedAt string         `json:"changed_at"`
+}
+
+func canTransition(from string, to string) bool {
+	for _, next := range eventTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Moves the event to a new status and records it in the history. New times
+// are only set when both are given. Returns the status the event had before.
+func changeEventStatus(db *sql.DB, eventId int, to string, reason string, changedBy sql.NullInt32, start *time.Time, end *time.Time) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	from, err := changeEventStatusTx(tx, eventId, to, reason, changedBy, start, end)
+	if err != nil {
+		return from, err
+	}
+
+	return from, tx.Commit()
+}
+
+// changeEventStatus within a transaction of the caller's
+func changeEventStatusTx(tx *sql.Tx, eventId int, to string, reason string, changedBy sql.NullInt32, start *time.Time, end *time.Time) (string, error) {
+	var from string
+	var ended bool
+	err := tx.QueryRow(`SELECT status, end_time < CURRENT_TIMESTAMP FROM public."Events" WHERE event_id = $1 FOR UPDATE`, eventId).Scan(&from, &ended)
+	if err != nil {
+		return "", err
+	}
+
+	if !canTransition(from, to) {
+		return from, fmt.Errorf("%w: %s events cannot become %s", errInvalidTransition, from, to)
+	}
+
+	if to == "completed" && !ended {
+		return from, fmt.Errorf("%w: events that have not ended cannot become completed", errInvalidTransition)
+	}
+
+	if start != nil && end != nil {
+		query := `UPDATE public."Events" SET status = $1, status_reason = NULLIF($2, ''), start_time = $3, end_time = $4 WHERE event_id = $5`
+		_, err = tx.Exec(query, to, reason, *start, *end, eventId)
+	} else {
+		query := `UPDATE public."Events" SET status = $1, status_reason = NULLIF($2, '') WHERE event_id = $3`
+		_, err = tx.Exec(query, to, reason, eventId)
+	}
+	if err != nil {
+		return from, err
+	}
+
+	query := `INSERT INTO public."Event_Status_History" (event_id, old_status, new_status, reason, changed_by)
+			VALUES ($1, $2, $3, NULLIF($4, ''), $5)`
+	_, err = tx.Exec(query, eventId, from, to, reason, changedBy)
+	return from, err
+}
+
+// Tells everyone attending the event that its status changed. Failures are
+// only logged, the change itself already happened.
+func notifyAttendees(ctx context.Context, db *sql.DB, eventId int, subject string, body string) {
+	query := `SELECT u.email FROM public."user_event_membership" uem
+			JOIN public."Users" u ON u.user_id = uem.user_id
+			WHERE uem.event_id = $1 AND u.email IS NOT NULL AND u.email <> ''`
+
+	rows, err := db.Query(query, eventId)
+	if err != nil {
+		log.Printf("Error getting attendees of event %d: %v", eventId, err)
+		return
+	}
+	defer rows.Close()
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err = rows.Scan(&email); err != nil {
+			log.Printf("Error scanning attendee of event %d: %v", eventId, err)
+			return
+		}
+		emails = append(emails, email)
+	}
+
+	for _, email := range emails {
+		err = notifier.Notify(ctx, notify.Message{To: email, Subject: subject, Body: body})
+		if err != nil {
+			log.Printf("Error notifying %s about event %d: %v", email, eventId, err)
+		}
+	}
+}
+
+func statusMessage(eventName string, status string, reason string) (string, string) {
+	subject := eventName + " has been " + status
+	if status == "scheduled" {
+		subject = eventName + " has been rescheduled"
+	}
+
+	body := subject + "."
+	if reason != "" {
+		body += "\n\nReason: " + reason
+	}
+
+	return subject, body
+}
+
+// Auth token required...
+// Organisers postpone, cancel, reschedule or complete their events
+func UpdateEventStatus(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	eventId, err := strconv.Atoi(chi.URLParam(r, "eventId"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid event ID",
+		})
+		return
+	}
+
+	var form EventStatusForm
+	err = json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "There was an error parsing the data",
+		})
+		return
+	}
+
+	form.Reason = strings.TrimSpace(form.Reason)
+	if (form.Status == "postponed" || form.Status == "cancelled") && form.Reason == "" {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "A reason is required to postpone or cancel an event",
+		})
+		return
+	}
+
+	organiser, err := isEventOrganiser(db, user.UserID, eventId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if !organiser {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Only the organisers of the event can change its status",
+		})
+		return
+	}
+
+	var start, end *time.Time
+	if form.Status == "scheduled" {
+		s, e, err := parseEventTimes(form.StartTime, form.EndTime)
+		if err != nil {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "New times are needed to reschedule: " + err.Error(),
+			})
+			return
+		}
+		start, end = &s, &e
+	}
+
+	_, err = changeEventStatus(db, eventId, form.Status, form.Reason, sql.NullInt32{Int32: int32(user.UserID), Valid: true}, start, end)
+	if err != nil {
+		if errors.Is(err, errInvalidTransition) {
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": err.Error(),
+			})
+			return
+		}
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Error changing the event status: " + err.Error(),
+		})
+		return
+	}
+
+	var eventName string
+	_ = db.QueryRow(`SELECT name FROM public."Events" WHERE event_id = $1`, eventId).Scan(&eventName)
+	subject, body := statusMessage(eventName, form.Status, form.Reason)
+	notifyAttendees(r.Context(), db, eventId, subject, body)
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "Event " + form.Status,
+	})
+}
+
+// Auth token required...
+func GetEventStatusHistory(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	// Anyone who can see the event can see why it changed
+	query := `SELECT h.old_status, h.new_status, h.reason, u.username, h.changed_at
+			FROM public."Event_Status_History" h
+			JOIN public."Events" e ON e.event_id = h.event_id
+			LEFT JOIN public."Users" u ON u.user_id = h.changed_by
+			WHERE h.event_id = $2 AND ` + visibleEventClause + `
+			ORDER BY h.changed_at`
+
+	rows, err := db.Query(query, user.UserID, chi.URLParam(r, "eventId"))
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting the status history",
+		})
+		return
+	}
+	defer rows.Close()
+
+	var history []EventStatusChange
+
+	for rows.Next() {
+		var change EventStatusChange
+		err = rows.Scan(&change.OldStatus, &change.NewStatus, &change.Reason, &change.ChangedBy, &change.ChangedAt)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Error getting the status history array",
+			})
+			return
+		}
+		history = append(history, change)
+	}
+
+	if err = rows.Err(); err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error iterating over rows",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data":   history,
+	})
+}
+
+// Marks scheduled and postponed events whose end_time has passed as completed, then keeps
+// doing so every interval until the context is done.
+func CompleteFinishedEvents(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		completeFinishedEvents(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func completeFinishedEvents(ctx context.Context) {
+	db, err := connectToDB()
+	if err != nil {
+		log.Printf("Error connecting to the DB to complete events: %v", err)
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT event_id, name FROM public."Events" WHERE status IN ('scheduled', 'postponed') AND end_time < CURRENT_TIMESTAMP`)
+	if err != nil {
+		log.Printf("Error getting finished events: %v", err)
+		return
+	}
+
+	finished := map[int]string{}
+	for rows.Next() {
+		var eventId int
+		var name string
+		if err = rows.Scan(&eventId, &name); err != nil {
+			log.Printf("Error scanning finished event: %v", err)
+			break
+		}
+		finished[eventId] = name
+	}
+	rows.Close()
+
+	for eventId, name := range finished {
+		_, err = changeEventStatus(db, eventId, "completed", "", sql.NullInt32{}, nil, nil)
+		if err != nil {
+			// Someone else changed it in the meantime, nothing to do
+			if errors.Is(err, errInvalidTransition) {
+				continue
+			}
+			log.Printf("Error completing event %d: %v", eventId, err)
+			continue
+		}
+
+		subject, body := statusMessage(name, "completed", "")
+		notifyAttendees(ctx, db, eventId, subject, body+"\n\nThanks for attending! You can now leave feedback on the event.")
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+// Only events that have ended can be completed, postponed ones included
+func TestCompleteEventOnlyOnceEnded(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+
+	_, err := changeEventStatus(db, f.online, "completed", "", sql.NullInt32{}, nil, nil)
+	if !errors.Is(err, errInvalidTransition) {
+		t.Fatalf("completing an upcoming event: got %v, want %v", err, errInvalidTransition)
+	}
+
+	query := `UPDATE public."Events" SET status = 'postponed',
+			start_time = CURRENT_TIMESTAMP - interval '3 hours', end_time = CURRENT_TIMESTAMP - interval '2 hours'
+			WHERE event_id = $1`
+	if _, err = db.Exec(query, f.online); err != nil {
+		t.Fatalf("moving the event into the past: %v", err)
+	}
+
+	from, err := changeEventStatus(db, f.online, "completed", "", sql.NullInt32{}, nil, nil)
+	if err != nil {
+		t.Fatalf("completing an ended postponed event: %v", err)
+	}
+	if from != "postponed" {
+		t.Errorf("previous status %q, want postponed", from)
+	}
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/lib/pq"
+)
+
+const (
+	// Radius in metres when ?radius= is left out
+	defaultRadius = 1000
+	maxRadius     = 50000
+)
+
+type NearbyLocation struct {
+	Location
+	Distance float64 `json:"distance_m"`
+}
+
+type NearbyEvent struct {
+	EventId    int     `json:"event_id"`
+	Name       string  `json:"name"`
+	Visibility string  `json:"visibility"`
+	Status     string  `json:"status"`
+	Mode       string  `json:"attendance_mode"`
+	LocId      int     `json:"loc_id"`
+	Address    string  `json:"address"`
+	Distance   float64 `json:"distance_m"`
+	EventTimes
+}
+
+// Columns of the Location aliased as l, in the order locationFields scans them
+const locationColumns = `l.loc_id, COALESCE(l.address, ''), l.latitude, l.longitude, l.parent_id, l.capacity, l.accessibility,
+		l.directions`
+
+// Scan destinations for locationColumns. Accessibility starts out empty so
+// places without features get [] rather than null.
+func locationFields(location *Location) []interface{} {
+	location.Accessibility = []string{}
+	return []interface{}{&location.LocId, &location.Address, &location.Latitude, &location.Longitude,
+		&location.ParentId, &location.Capacity, pq.Array(&location.Accessibility), &location.Directions}
+}
+
+// Reads ?lat=, ?lng= and ?radius= (metres)
+func parseRadiusQuery(r *http.Request) (float64, float64, float64, error) {
+	params := r.URL.Query()
+
+	lat, err := strconv.ParseFloat(params.Get("lat"), 64)
+	if err != nil {
+		return 0, 0, 0, errors.New("lat and lng are required")
+	}
+	lng, err := strconv.ParseFloat(params.Get("lng"), 64)
+	if err != nil {
+		return 0, 0, 0, errors.New("lat and lng are required")
+	}
+	if err = validateCoordinates(&lat, &lng); err != nil {
+		return 0, 0, 0, err
+	}
+
+	radius := float64(defaultRadius)
+	if value := params.Get("radius"); value != "" {
+		radius, err = strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(radius) || radius <= 0 || radius > maxRadius {
+			return 0, 0, 0, errors.New("radius must be a number of metres between 0 and 50000")
+		}
+	}
+
+	return lat, lng, radius, nil
+}
+
+// Distance in metres between the point given by the placeholders and the
+// location aliased as l
+func distanceFrom(lat string, lng string) string {
+	return `earth_distance(ll_to_earth(` + lat + `, ` + lng + `), ll_to_earth(l.latitude, l.longitude))`
+}
+
+// The earth_box test lets the locations_by_position index narrow the rows
+// down before the exact distance is checked
+func withinRadius(lat string, lng string, radius string) string {
+	return `l.latitude IS NOT NULL
+		AND earth_box(ll_to_earth(` + lat + `, ` + lng + `), ` + radius + `) @> ll_to_earth(l.latitude, l.longitude)
+		AND ` + distanceFrom(lat, lng) + ` <= ` + radius
+}
+
+// The locations around a point, closest first
+func GetLocations(w http.ResponseWriter, r *http.Request) {
+	lat, lng, radius, err := parseRadiusQuery(r)
+	var features []string
+	if err == nil {
+		features, err = parseAccessibilityFilter(r)
+	}
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	query := `SELECT ` + locationColumns + `, ` + distanceFrom("$1", "$2") + ` AS distance
+			FROM public."Locations" l
+			WHERE ` + withinRadius("$1", "$2", "$3") + `
+			AND ` + accessibleClause("$4") + `
+			ORDER BY distance`
+
+	rows, err := db.Query(query, lat, lng, radius, pq.Array(features))
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting Locations",
+		})
+		return
+	}
+	defer rows.Close()
+
+	locations := []NearbyLocation{}
+	for rows.Next() {
+		var location NearbyLocation
+		err = rows.Scan(append(locationFields(&location.Location), &location.Distance)...)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Error getting Locations array",
+			})
+			return
+		}
+		locations = append(locations, location)
+	}
+
+	if err = rows.Err(); err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error iterating over rows",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data":   locations,
+	})
+}
+
+// Auth token required...
+// Upcoming events the user may see around a point, closest first
+func GetNearbyEvents(w http.ResponseWriter, r *http.Request) {
+	lat, lng, radius, err := parseRadiusQuery(r)
+	var features []string
+	if err == nil {
+		features, err = parseAccessibilityFilter(r)
+	}
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	tx, err := BeginUserTx(db, user)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	page, perPage := parsePage(r)
+
+	// visibleEventClause takes the user as $1
+	query := `SELECT e.event_id, e.name, e.visibility, e.status, e.attendance_mode, e.start_time, e.end_time, e.time_zone,
+			l.loc_id, COALESCE(l.address, ''), ` + distanceFrom("$2", "$3") + ` AS distance
+			FROM public."Events" e
+			JOIN public."Locations" l ON l.loc_id = e.loc_id
+			WHERE ` + withinRadius("$2", "$3", "$4") + `
+			AND e.end_time > CURRENT_TIMESTAMP AND e.status IN ('scheduled', 'postponed')
+			AND ` + visibleEventClause + `
+			AND ` + accessibleClause("$7") + `
+			ORDER BY distance, e.start_time
+			LIMIT $5 OFFSET $6`
+
+	rows, err := tx.Query(query, user.UserID, lat, lng, radius, perPage, (page-1)*perPage, pq.Array(features))
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting Events",
+		})
+		return
+	}
+	defer rows.Close()
+
+	events := []NearbyEvent{}
+	for rows.Next() {
+		var event NearbyEvent
+		var start, end time.Time
+		var zone string
+		err = rows.Scan(&event.EventId, &event.Name, &event.Visibility, &event.Status, &event.Mode, &start, &end, &zone,
+			&event.LocId, &event.Address, &event.Distance)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Error getting Events array",
+			})
+			return
+		}
+		event.EventTimes = newEventTimes(start, end, zone)
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error iterating over rows",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":   "success",
+		"data":     events,
+		"page":     page,
+		"per_page": perPage,
+	})
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseRadiusQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr bool
+	}{
+		{"lat=28.6&lng=-81.2", false},
+		{"lat=28.6&lng=-81.2&radius=500", false},
+		{"lat=-90&lng=180", false},
+		{"lng=-81.2", true},
+		{"lat=91&lng=0", true},
+		{"lat=0&lng=-181", true},
+		{"lat=NaN&lng=0", true},
+		{"lat=0&lng=NaN", true},
+		{"lat=Inf&lng=0", true},
+		{"lat=0&lng=-Inf", true},
+		{"lat=0&lng=0&radius=NaN", true},
+		{"lat=0&lng=0&radius=Inf", true},
+		{"lat=0&lng=0&radius=0", true},
+		{"lat=0&lng=0&radius=50001", true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+		if _, _, _, err := parseRadiusQuery(r); (err != nil) != tt.wantErr {
+			t.Errorf("%q: error %v, want error %v", tt.query, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/bingKegeta/Knight-Link/internal/media"
+)
+
+// Largest accepted upload
+const maxUploadSize = 5 << 20
+
+// Files are kept in Postgres unless main configures another store
+var mediaStore media.Store = media.DBStore{Open: connectToDB}
+
+func SetMediaStore(s media.Store) {
+	mediaStore = s
+}
+
+// Where the file of a media row is served, nil when there is none
+func mediaURL(mediaId sql.NullInt32) *string {
+	if !mediaId.Valid {
+		return nil
+	}
+	url := "/v1/api/media/" + strconv.Itoa(int(mediaId.Int32))
+	return &url
+}
+
+// Reads the "file" field of a multipart upload, checks it is an image and
+// stores it with its thumbnail. Returns the new media id.
+func saveImageUpload(w http.ResponseWriter, r *http.Request, db *sql.DB, userId int) (int, int, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize+1<<20)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		return 0, http.StatusBadRequest, errors.New("the upload must be a multipart form with a file of at most 5 MB")
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return 0, http.StatusBadRequest, errors.New("the upload has no file field")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxUploadSize+1))
+	if err != nil {
+		return 0, http.StatusBadRequest, err
+	}
+	if len(data) > maxUploadSize {
+		return 0, http.StatusRequestEntityTooLarge, errors.New("the file is larger than 5 MB")
+	}
+
+	img, err := media.ProcessImage(data)
+	if err != nil {
+		return 0, http.StatusUnsupportedMediaType, err
+	}
+
+	key, err := media.NewKey()
+	if err != nil {
+		return 0, http.StatusInternalServerError, err
+	}
+	thumbKey := key + "-thumb"
+
+	ctx := r.Context()
+	if err = mediaStore.Put(ctx, key, data, img.ContentType); err != nil {
+		return 0, http.StatusInternalServerError, err
+	}
+	if err = mediaStore.Put(ctx, thumbKey, img.Thumb, img.ThumbType); err != nil {
+		mediaStore.Delete(ctx, key)
+		return 0, http.StatusInternalServerError, err
+	}
+
+	sum := sha256.Sum256(data)
+
+	var mediaId int
+	query := `INSERT INTO public."Media" (storage_key, content_type, size_bytes, width, height, thumb_key, thumb_type, etag, uploaded_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING media_id`
+	err = db.QueryRow(query, key, img.ContentType, len(data), img.Width, img.Height, thumbKey, img.ThumbType,
+		hex.EncodeToString(sum[:]), userId).Scan(&mediaId)
+	if err != nil {
+		mediaStore.Delete(ctx, key)
+		mediaStore.Delete(ctx, thumbKey)
+		return 0, http.StatusInternalServerError, err
+	}
+
+	return mediaId, http.StatusCreated, nil
+}
+
+// Removes a media row and its files. Failures are only logged, a stray file
+// does no harm.
+func deleteMedia(ctx context.Context, db *sql.DB, mediaId int) {
+	var key string
+	var thumbKey sql.NullString
+	query := `DELETE FROM public."Media" WHERE media_id = $1 RETURNING storage_key, thumb_key`
+	err := db.QueryRow(query, mediaId).Scan(&key, &thumbKey)
+	if err != nil {
+		log.Printf("Error deleting media %d: %v", mediaId, err)
+		return
+	}
+
+	for _, k := range []string{key, thumbKey.String} {
+		if k == "" {
+			continue
+		}
+		if err = mediaStore.Delete(ctx, k); err != nil {
+			log.Printf("Error deleting the file %s of media %d: %v", k, mediaId, err)
+		}
+	}
+}
+
+// GET /media/{mediaId} and /media/{mediaId}/thumb. Media never change once
+// uploaded, so browsers and proxies may keep them for good.
+func GetMedia(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	var key, etag string
+	var thumbKey sql.NullString
+	query := `SELECT storage_key, thumb_key, etag FROM public."Media" WHERE media_id = $1`
+	err = db.QueryRow(query, chi.URLParam(r, "mediaId")).Scan(&key, &thumbKey, &etag)
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Media not found",
+		})
+		return
+	}
+
+	thumb := chi.URLParam(r, "variant") == "thumb"
+	if thumb {
+		if !thumbKey.Valid {
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "This media has no thumbnail",
+			})
+			return
+		}
+		key = thumbKey.String
+		etag += "-thumb"
+	}
+
+	etag = `"` + etag + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	data, contentType, err := mediaStore.Get(r.Context(), key)
+	if err != nil {
+		w.Header().Del("Cache-Control")
+		if errors.Is(err, media.ErrNotFound) {
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Media not found",
+			})
+			return
+		}
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Error reading the media: " + err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(data)
+}
+
+// Auth token required...
+// Officers upload the RSO's logo as a multipart form with a "file" field
+func UploadRSOLogo(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, ok := checkRSOOfficer(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	var oldLogo sql.NullInt32
+	err = db.QueryRow(`SELECT logo_id FROM public."RSOs" WHERE rso_id = $1 AND archived_at IS NULL`, rsoId).Scan(&oldLogo)
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "RSO not found",
+		})
+		return
+	}
+
+	mediaId, status, err := saveImageUpload(w, r, db, user.UserID)
+	if err != nil {
+		render.Status(r, status)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	_, err = db.Exec(`UPDATE public."RSOs" SET logo_id = $1 WHERE rso_id = $2`, mediaId, rsoId)
+	if err != nil {
+		deleteMedia(r.Context(), db, mediaId)
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if oldLogo.Valid {
+		deleteMedia(r.Context(), db, int(oldLogo.Int32))
+	}
+
+	logo := sql.NullInt32{Int32: int32(mediaId), Valid: true}
+	render.Status(r, status)
+	render.JSON(w, r, map[string]interface{}{
+		"status":   "success",
+		"message":  "Logo uploaded",
+		"logo_url": mediaURL(logo),
+	})
+}
+
+// Auth token required...
+func DeleteRSOLogo(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, ok := checkRSOOfficer(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	var logo sql.NullInt32
+	query := `UPDATE public."RSOs" r SET logo_id = NULL FROM public."RSOs" old
+			WHERE r.rso_id = old.rso_id AND r.rso_id = $1 RETURNING old.logo_id`
+	err = db.QueryRow(query, rsoId).Scan(&logo)
+	if err != nil || !logo.Valid {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "This RSO has no logo",
+		})
+		return
+	}
+
+	deleteMedia(r.Context(), db, int(logo.Int32))
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "Logo removed",
+	})
+}
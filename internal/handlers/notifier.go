@@ -0,0 +1,12 @@
+package handlers
+
+import (
+	"github.com/bingKegeta/Knight-Link/internal/notify"
+)
+
+// Where user facing messages go. Swapped at startup when email is configured
+var notifier notify.Notifier = notify.LogNotifier{}
+
+func SetNotifier(n notify.Notifier) {
+	notifier = n
+}
@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+const (
+	defaultPageSize = 25
+	maxPageSize     = 100
+)
+
+type RosterMember struct {
+	Username   string         `json:"username"`
+	FirstName  sql.NullString `json:"first_name"`
+	LastName   sql.NullString `json:"last_name"`
+	Email      *string        `json:"email,omitempty"`
+	Role       string         `json:"role"`
+	DateJoined string         `json:"date_joined"`
+}
+
+// Reads ?page= (from 1) and ?per_page= with sane defaults and limits
+func parsePage(r *http.Request) (page int, perPage int) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	perPage, err = strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = defaultPageSize
+	}
+	if perPage > maxPageSize {
+		perPage = maxPageSize
+	}
+
+	return page, perPage
+}
+
+// Members with officers and the admin first. A perPage of 0 returns everyone.
+func queryRoster(db querier, rsoId int, withEmail bool, page int, perPage int) ([]RosterMember, error) {
+	query := `SELECT u.username, u.first_name, u.last_name, u.email, m.role, m.date_joined
+			FROM public."User_RSO_Membership" m
+			JOIN public."Users" u ON u.user_id = m.user_id
+			WHERE m.rso_id = $1
+			ORDER BY m.role DESC, u.username`
+	args := []interface{}{rsoId}
+	if perPage > 0 {
+		query += ` LIMIT $2 OFFSET $3`
+		args = append(args, perPage, (page-1)*perPage)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []RosterMember
+	for rows.Next() {
+		var member RosterMember
+		var email sql.NullString
+		err = rows.Scan(&member.Username, &member.FirstName, &member.LastName, &email, &member.Role, &member.DateJoined)
+		if err != nil {
+			return nil, err
+		}
+		if withEmail && email.Valid {
+			member.Email = &email.String
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// Auth token required...
+// Members see the roster, officers also see the emails
+func GetRSOMembers(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, err := strconv.Atoi(chi.URLParam(r, "rsoId"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid RSO ID",
+		})
+		return
+	}
+
+	role, err := rsoRole(db, user.UserID, rsoId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	superadmin, err := isSuperadminOfRSO(db, user, rsoId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if role == "" && !superadmin {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Only members of the RSO can see its roster",
+		})
+		return
+	}
+
+	tx, err := BeginUserTx(db, user)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var total int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM public."User_RSO_Membership" WHERE rso_id = $1`, rsoId).Scan(&total)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	page, perPage := parsePage(r)
+	officer := role == "officer" || role == "admin" || superadmin
+	members, err := queryRoster(tx, rsoId, officer, page, perPage)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting the roster",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":   "success",
+		"data":     members,
+		"page":     page,
+		"per_page": perPage,
+		"total":    total,
+	})
+}
+
+// Auth token required...
+// Names are chosen by the members, so a cell a spreadsheet would run as a
+// formula is quoted with a leading '
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// The whole roster for officers, ?format=csv (default) or json
+func ExportRSOMembers(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, ok := checkRSOOfficer(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "format must be csv or json",
+		})
+		return
+	}
+
+	members, err := queryRoster(db, rsoId, true, 1, 0)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting the roster",
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("rso-%d-members.%s", rsoId, format)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	if format == "json" {
+		render.JSON(w, r, members)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{"username", "first_name", "last_name", "email", "role", "date_joined"})
+	for _, member := range members {
+		email := ""
+		if member.Email != nil {
+			email = *member.Email
+		}
+		_ = out.Write([]string{csvCell(member.Username), csvCell(member.FirstName.String), csvCell(member.LastName.String),
+			csvCell(email), member.Role, member.DateJoined})
+	}
+	out.Flush()
+}
+
+// Auth token required...
+// The admin removes a member. The admin themselves leaves through a transfer.
+func RemoveRSOMember(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, ok := checkRSOAdmin(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	var userId int
+	var role string
+	query := `SELECT u.user_id, m.role FROM public."Users" u
+			JOIN public."User_RSO_Membership" m ON m.user_id = u.user_id
+			WHERE u.username = $1 AND m.rso_id = $2`
+	err = db.QueryRow(query, chi.URLParam(r, "username"), rsoId).Scan(&userId, &role)
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "This user is not a member of the RSO",
+		})
+		return
+	}
+
+	if role == "admin" {
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Transfer the RSO to another member before leaving it",
+		})
+		return
+	}
+
+	err = changeMembership(db, rsoId, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM public."User_RSO_Membership" WHERE user_id = $1 AND rso_id = $2`, userId, rsoId)
+		if err != nil {
+			return err
+		}
+
+		// A pending transfer to the removed member cannot be accepted anymore
+		_, err = tx.Exec(`DELETE FROM public."RSO_Admin_Transfers" WHERE rso_id = $1 AND to_user = $2`, rsoId, userId)
+		return err
+	})
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Error removing the member: " + err.Error(),
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "Member removed",
+	})
+}
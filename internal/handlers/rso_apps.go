@@ -0,0 +1,707 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/lib/pq"
+)
+
+// The applicant becomes the admin, the three students co-found the RSO
+type RsoApplicationForm struct {
+	Name        string `json:"rso_name"`
+	Description string `json:"description"`
+	Sone        string `json:"s1_name"`
+	Stwo        string `json:"s2_name"`
+	Sthree      string `json:"s3_name"`
+}
+
+type RsoAppFounder struct {
+	Username string `json:"username"`
+	Status   string `json:"status"`
+}
+
+type RsoApplication struct {
+	AppId         int             `json:"app_id"`
+	Name          string          `json:"rso_name"`
+	Description   sql.NullString  `json:"description"`
+	UniId         int             `json:"uni_id"`
+	Admin         string          `json:"admin"`
+	Status        string          `json:"status"`
+	DateSubmitted string          `json:"date_submitted"`
+	ReviewNote    sql.NullString  `json:"review_note"`
+	Founders      []RsoAppFounder `json:"founders"`
+}
+
+type FounderResponse struct {
+	Accept bool `json:"accept"`
+}
+
+type RsoAppReview struct {
+	Approve bool   `json:"approve"`
+	Note    string `json:"note"`
+}
+
+var errAppNotSubmitted = errors.New("only submitted applications can be reviewed")
+
+// Looks up the founders and checks they are four different students of the
+// same university sharing an email domain. Returns their ids in order and the
+// university.
+func validateFounders(db *sql.DB, usernames []string) ([]int, int, error) {
+	seen := map[string]bool{}
+	ids := []int{}
+	uniId := 0
+	domain := ""
+
+	for _, username := range usernames {
+		if username == "" {
+			return nil, 0, errors.New("an application needs an admin and three other students")
+		}
+		if seen[username] {
+			return nil, 0, fmt.Errorf("%s is listed more than once", username)
+		}
+		seen[username] = true
+
+		var userId, userUni int
+		var email sql.NullString
+		query := `SELECT user_id, uni_id, email FROM public."Users" WHERE username = $1`
+		err := db.QueryRow(query, username).Scan(&userId, &userUni, &email)
+		if err == sql.ErrNoRows {
+			return nil, 0, fmt.Errorf("user %s not found", username)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		at := strings.LastIndex(email.String, "@")
+		if at < 0 {
+			return nil, 0, fmt.Errorf("%s has no valid email address", username)
+		}
+		userDomain := strings.ToLower(email.String[at+1:])
+
+		if uniId == 0 {
+			uniId = userUni
+			domain = userDomain
+		}
+		if userUni != uniId {
+			return nil, 0, errors.New("all founders must attend the same university")
+		}
+		if userDomain != domain {
+			return nil, 0, errors.New("all founders must share the same email domain")
+		}
+
+		ids = append(ids, userId)
+	}
+
+	return ids, uniId, nil
+}
+
+// Runs the query (which must select the RsoApplication columns in order) and
+// attaches the founders of every application found
+func queryApplications(db *sql.DB, query string, args ...interface{}) ([]RsoApplication, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	apps := []RsoApplication{}
+	index := map[int]int{}
+	var appIds []int64
+
+	for rows.Next() {
+		var app RsoApplication
+		err = rows.Scan(&app.AppId, &app.Name, &app.Description, &app.UniId, &app.Admin, &app.Status,
+			&app.DateSubmitted, &app.ReviewNote)
+		if err != nil {
+			return nil, err
+		}
+		app.Founders = []RsoAppFounder{}
+		index[app.AppId] = len(apps)
+		appIds = append(appIds, int64(app.AppId))
+		apps = append(apps, app)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(apps) == 0 {
+		return apps, nil
+	}
+
+	founderRows, err := db.Query(`SELECT f.app_id, u.username, f.status FROM public."RSO_App_Founders" f
+			JOIN public."Users" u ON u.user_id = f.user_id
+			WHERE f.app_id = ANY($1)`, pq.Array(appIds))
+	if err != nil {
+		return nil, err
+	}
+	defer founderRows.Close()
+
+	for founderRows.Next() {
+		var appId int
+		var founder RsoAppFounder
+		if err = founderRows.Scan(&appId, &founder.Username, &founder.Status); err != nil {
+			return nil, err
+		}
+		apps[index[appId]].Founders = append(apps[index[appId]].Founders, founder)
+	}
+
+	return apps, founderRows.Err()
+}
+
+const applicationColumns = `SELECT a.id, a.name, a.description, a.uni_id, u.username, a.status, a.date_submitted, a.review_note
+		FROM public."RSO_Apps" a
+		JOIN public."Users" u ON u.user_id = a.admin_id`
+
+// Auth token required...
+// A student applies to found an RSO, naming three co-founders
+func SubmitRSOApplication(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	var form RsoApplicationForm
+	err = json.NewDecoder(r.Body).Decode(&form)
+	if err != nil || strings.TrimSpace(form.Name) == "" {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "Error",
+			"message": "An RSO name is required",
+		})
+		return
+	}
+
+	ids, uniId, err := validateFounders(db, []string{user.UserName, form.Sone, form.Stwo, form.Sthree})
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "Error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var taken bool
+	err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM public."RSOs" WHERE name = $1)`, form.Name).Scan(&taken)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if taken {
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "Error",
+			"message": "An RSO with this name already exists",
+		})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var appId int
+	query := `INSERT INTO public."RSO_Apps" (name, description, uni_id, admin_id, student1_id, student2_id, student3_id)
+			VALUES ($1, COALESCE(NULLIF($2, ''), 'None given'), $3, $4, $5, $6, $7) RETURNING id`
+	err = tx.QueryRow(query, form.Name, form.Description, uniId, ids[0], ids[1], ids[2], ids[3]).Scan(&appId)
+	if err != nil {
+		if pgerr, ok := err.(*pq.Error); ok && pgerr.Code == "23505" {
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "Error",
+				"message": "There is already an open application for this name",
+			})
+			return
+		}
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "Error",
+			"message": "Failed to submit application " + err.Error(),
+		})
+		return
+	}
+
+	for _, founderId := range ids[1:] {
+		_, err = tx.Exec(`INSERT INTO public."RSO_App_Founders" (app_id, user_id) VALUES ($1, $2)`, appId, founderId)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "Error",
+				"message": "Failed to invite co-founders " + err.Error(),
+			})
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "Success",
+		"message": "Application created, waiting for the co-founders to confirm",
+		"app_id":  appId,
+	})
+}
+
+// Auth token required...
+// Applications the user is the admin or a co-founder of
+func GetUserRSOApplications(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	query := applicationColumns + `
+		WHERE a.admin_id = $1 OR EXISTS (SELECT 1 FROM public."RSO_App_Founders" f WHERE f.app_id = a.id AND f.user_id = $1)
+		ORDER BY a.date_submitted DESC`
+
+	apps, err := queryApplications(db, query, user.UserID)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting applications",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data":   apps,
+	})
+}
+
+// Auth token required...
+// A co-founder confirms or declines being part of the application. Once all
+// three confirm it goes to the superadmins, one decline withdraws it.
+func ConfirmRSOApplication(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	appId, err := strconv.Atoi(chi.URLParam(r, "appId"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid application ID",
+		})
+		return
+	}
+
+	var response FounderResponse
+	err = json.NewDecoder(r.Body).Decode(&response)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "There was an error parsing the data",
+		})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var appStatus string
+	err = tx.QueryRow(`SELECT status FROM public."RSO_Apps" WHERE id = $1 FOR UPDATE`, appId).Scan(&appStatus)
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Application not found",
+		})
+		return
+	}
+
+	if appStatus != "awaiting_founders" {
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "This application is no longer waiting for co-founders",
+		})
+		return
+	}
+
+	status := "declined"
+	if response.Accept {
+		status = "accepted"
+	}
+
+	query := `UPDATE public."RSO_App_Founders" SET status = $1, date_responded = CURRENT_TIMESTAMP
+			WHERE app_id = $2 AND user_id = $3 AND status = 'pending'`
+	result, err := tx.Exec(query, status, appId, user.UserID)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "You have no pending confirmation for this application",
+		})
+		return
+	}
+
+	if response.Accept {
+		query = `UPDATE public."RSO_Apps" SET status = 'submitted'
+				WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM public."RSO_App_Founders" WHERE app_id = $1 AND status <> 'accepted')`
+	} else {
+		query = `UPDATE public."RSO_Apps" SET status = 'withdrawn' WHERE id = $1`
+	}
+	_, err = tx.Exec(query, appId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "Application " + status,
+	})
+}
+
+// Auth token required...
+// Applications every co-founder confirmed, waiting for a superadmin
+func GetRSOApplicationQueue(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	if user.UserType != "superadmin" {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Only superadmins can review applications",
+		})
+		return
+	}
+
+	// Superadmins only see the applications of their universities
+	query := applicationColumns + `
+		WHERE a.status = 'submitted'
+		AND ($1 OR a.uni_id IN (SELECT uni_id FROM public."Superadmin_Universities" WHERE user_id = $2))
+		ORDER BY a.date_submitted`
+
+	apps, err := queryApplications(db, query, user.PlatformAdmin, user.UserID)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting applications",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data":   apps,
+	})
+}
+
+// Creates the RSO of an approved application in one transaction: the RSO,
+// the memberships of all four founders and the promotion of the admin.
+func approveRSOApplication(db *sql.DB, appId int, reviewerId int, note string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var name, status string
+	var description sql.NullString
+	var uniId, rsoId int
+	var founders [4]int
+	query := `SELECT name, description, uni_id, admin_id, student1_id, student2_id, student3_id, status
+			FROM public."RSO_Apps" WHERE id = $1 FOR UPDATE`
+	err = tx.QueryRow(query, appId).Scan(&name, &description, &uniId, &founders[0], &founders[1],
+		&founders[2], &founders[3], &status)
+	if err != nil {
+		return 0, err
+	}
+
+	if status != "submitted" {
+		return 0, errAppNotSubmitted
+	}
+
+	query = `INSERT INTO public."RSOs" (name, description, uni_id, admin_id, date_created)
+			VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP) RETURNING rso_id`
+	err = tx.QueryRow(query, name, description, uniId, founders[0]).Scan(&rsoId)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, userId := range founders {
+		role := "member"
+		if i == 0 {
+			role = "admin"
+		}
+		_, err = tx.Exec(`INSERT INTO public."User_RSO_Membership" (user_id, rso_id, role) VALUES ($1, $2, $3)`, userId, rsoId, role)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Memberships go in first so validate_admin_association accepts the promotion
+	_, err = tx.Exec(`UPDATE public."Users" SET user_type = 'admin' WHERE user_id = $1 AND user_type = 'student'`, founders[0])
+	if err != nil {
+		return 0, err
+	}
+
+	query = `UPDATE public."RSO_Apps" SET status = 'approved', superadmin_approval = TRUE, reviewed_by = $1, review_note = NULLIF($2, '')
+			WHERE id = $3`
+	_, err = tx.Exec(query, reviewerId, note, appId)
+	if err != nil {
+		return 0, err
+	}
+
+	return rsoId, tx.Commit()
+}
+
+// Auth token required...
+func ReviewRSOApplication(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	if user.UserType != "superadmin" {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Only superadmins can review applications",
+		})
+		return
+	}
+
+	appId, err := strconv.Atoi(chi.URLParam(r, "appId"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid application ID",
+		})
+		return
+	}
+
+	var uniId int
+	err = db.QueryRow(`SELECT uni_id FROM public."RSO_Apps" WHERE id = $1`, appId).Scan(&uniId)
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Application not found",
+		})
+		return
+	}
+
+	allowed, err := isSuperadminOf(db, user, uniId)
+	if err != nil || !allowed {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Only superadmins of the university can review its applications",
+		})
+		return
+	}
+
+	var review RsoAppReview
+	err = json.NewDecoder(r.Body).Decode(&review)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "There was an error parsing the data",
+		})
+		return
+	}
+
+	if !review.Approve {
+		query := `UPDATE public."RSO_Apps" SET status = 'rejected', reviewed_by = $1, review_note = NULLIF($2, '')
+				WHERE id = $3 AND status = 'submitted'`
+		result, err := db.Exec(query, user.UserID, review.Note, appId)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "error",
+				"message": "Database error: " + err.Error(),
+			})
+			return
+		}
+
+		if n, _ := result.RowsAffected(); n == 0 {
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": errAppNotSubmitted.Error(),
+			})
+			return
+		}
+
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "success",
+			"message": "Application rejected",
+		})
+		return
+	}
+
+	rsoId, err := approveRSOApplication(db, appId, user.UserID, review.Note)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Application not found",
+			})
+		case errors.Is(err, errAppNotSubmitted):
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": err.Error(),
+			})
+		default:
+			if pgerr, ok := err.(*pq.Error); ok && pgerr.Code == "23505" {
+				render.Status(r, http.StatusConflict)
+				render.JSON(w, r, map[string]interface{}{
+					"status":  "Error",
+					"message": "An RSO with this name already exists",
+				})
+				return
+			}
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "Error",
+				"message": "Failed to create RSO " + err.Error(),
+			})
+		}
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "Success",
+		"message": "Application approved, RSO created",
+		"rso_id":  rsoId,
+	})
+}
@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/bingKegeta/Knight-Link/internal/notify"
+)
+
+type JoinRequest struct {
+	RequestId     int            `json:"request_id"`
+	RsoId         int            `json:"rso_id"`
+	RsoName       string         `json:"rso_name"`
+	Username      string         `json:"username"`
+	Kind          string         `json:"kind"`
+	Message       sql.NullString `json:"message"`
+	Status        string         `json:"status"`
+	DateRequested string         `json:"date_requested"`
+}
+
+type JoinReview struct {
+	Approve bool `json:"approve"`
+}
+
+type RsoInviteForm struct {
+	Username string `json:"username"`
+}
+
+type RsoInviteResponse struct {
+	Accept bool `json:"accept"`
+}
+
+func validJoinPolicy(policy string) bool {
+	return policy == "open" || policy == "approval" || policy == "invite_only"
+}
+
+// The pending invitation of the user to the RSO, 0 when there is none
+func pendingRSOInvite(db *sql.DB, rsoId int, userId int) (int, error) {
+	var requestId int
+	query := `SELECT request_id FROM public."RSO_Join_Requests"
+			WHERE rso_id = $1 AND user_id = $2 AND kind = 'invite' AND status = 'pending'`
+	err := db.QueryRow(query, rsoId, userId).Scan(&requestId)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	return requestId, err
+}
+
+// Asking again while a request is pending only updates its message
+func requestToJoinRSO(db *sql.DB, rsoId int, userId int, message string) error {
+	query := `INSERT INTO public."RSO_Join_Requests" (rso_id, user_id, kind, message)
+			VALUES ($1, $2, 'request', NULLIF($3, ''))
+			ON CONFLICT (rso_id, user_id) WHERE status = 'pending'
+			DO UPDATE SET message = EXCLUDED.message, date_requested = CURRENT_TIMESTAMP`
+	_, err := db.Exec(query, rsoId, userId, strings.TrimSpace(message))
+	return err
+}
+
+// Adds the member and closes the request or invitation that let them in, if any
+func addRSOMember(db *sql.DB, rsoId int, userId int, requestId int, reviewer sql.NullInt32) error {
+	return changeMembership(db, rsoId, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO public."User_RSO_Membership" (user_id, rso_id) VALUES ($1, $2)`, userId, rsoId)
+		if err != nil || requestId == 0 {
+			return err
+		}
+
+		query := `UPDATE public."RSO_Join_Requests" SET status = 'approved', date_reviewed = CURRENT_TIMESTAMP,
+				reviewed_by = COALESCE($1, reviewed_by)
+				WHERE request_id = $2`
+		_, err = tx.Exec(query, reviewer, requestId)
+		return err
+	})
+}
+
+// Parses the RSO in the URL and checks the user is one of its officers or a
+// superadmin of its university. Writes the error response itself and returns
+// false when the request should stop.
+func checkRSOOfficer(db *sql.DB, w http.ResponseWriter, r *http.Request, user SessionUser) (int, bool) {
+	rsoId, err := strconv.Atoi(chi.URLParam(r, "rsoId"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid RSO ID",
+		})
+		return 0, false
+	}
+
+	officer, err := isRSOOfficer(db, user.UserID, rsoId)
+	if err == nil && !officer {
+		officer, err = isSuperadminOfRSO(db, user, rsoId)
+	}
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return 0, false
+	}
+
+	if !officer {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Only officers of the RSO can do this",
+		})
+		return 0, false
+	}
+
+	return rsoId, true
+}
+
+func queryJoinRequests(db *sql.DB, where string, args ...interface{}) ([]JoinRequest, error) {
+	query := `SELECT j.request_id, j.rso_id, r.name, u.username, j.kind, j.message, j.status, j.date_requested
+			FROM public."RSO_Join_Requests" j
+			JOIN public."RSOs" r ON r.rso_id = j.rso_id
+			JOIN public."Users" u ON u.user_id = j.user_id
+			WHERE ` + where + `
+			ORDER BY j.date_requested`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []JoinRequest
+	for rows.Next() {
+		var request JoinRequest
+		err = rows.Scan(&request.RequestId, &request.RsoId, &request.RsoName, &request.Username, &request.Kind,
+			&request.Message, &request.Status, &request.DateRequested)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+
+	return requests, rows.Err()
+}
+
+func notifyUser(r *http.Request, db *sql.DB, userId int, subject string, body string) {
+	var email sql.NullString
+	err := db.QueryRow(`SELECT email FROM public."Users" WHERE user_id = $1`, userId).Scan(&email)
+	if err != nil || email.String == "" {
+		log.Printf("Could not notify user %d: %v", userId, err)
+		return
+	}
+
+	err = notifier.Notify(r.Context(), notify.Message{To: email.String, Subject: subject, Body: body})
+	if err != nil {
+		log.Printf("Error notifying user %d: %v", userId, err)
+	}
+}
+
+// Tells the officers and the admin of the RSO, e.g. of a new join request
+func notifyOfficers(r *http.Request, db *sql.DB, rsoId int, subject string, body string) {
+	query := `SELECT u.email FROM public."User_RSO_Membership" m
+			JOIN public."Users" u ON u.user_id = m.user_id
+			WHERE m.rso_id = $1 AND m.role IN ('officer', 'admin') AND u.email IS NOT NULL AND u.email <> ''`
+
+	rows, err := db.Query(query, rsoId)
+	if err != nil {
+		log.Printf("Error getting officers of RSO %d: %v", rsoId, err)
+		return
+	}
+	defer rows.Close()
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err = rows.Scan(&email); err != nil {
+			log.Printf("Error scanning officer of RSO %d: %v", rsoId, err)
+			return
+		}
+		emails = append(emails, email)
+	}
+
+	for _, email := range emails {
+		err = notifier.Notify(r.Context(), notify.Message{To: email, Subject: subject, Body: body})
+		if err != nil {
+			log.Printf("Error notifying %s about RSO %d: %v", email, rsoId, err)
+		}
+	}
+}
+
+// Auth token required...
+// Pending requests and invitations of the RSO, for its officers
+func GetRSOJoinRequests(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, ok := checkRSOOfficer(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	requests, err := queryJoinRequests(db, `j.rso_id = $1 AND j.status = 'pending'`, rsoId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting join requests",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data":   requests,
+	})
+}
+
+// Auth token required...
+// The user's own pending requests and the invitations they received
+func GetUserJoinRequests(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	requests, err := queryJoinRequests(db, `j.user_id = $1 AND j.status = 'pending'`, user.UserID)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting join requests",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data":   requests,
+	})
+}
+
+// Auth token required...
+// Officers approve or deny a request to join
+func ReviewJoinRequest(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, ok := checkRSOOfficer(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	var review JoinReview
+	err = json.NewDecoder(r.Body).Decode(&review)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "There was an error parsing the data",
+		})
+		return
+	}
+
+	var requestId, userId int
+	var rsoName string
+	query := `SELECT j.request_id, j.user_id, r.name FROM public."RSO_Join_Requests" j
+			JOIN public."RSOs" r ON r.rso_id = j.rso_id
+			WHERE j.request_id = $1 AND j.rso_id = $2 AND j.kind = 'request' AND j.status = 'pending'`
+	err = db.QueryRow(query, chi.URLParam(r, "requestId"), rsoId).Scan(&requestId, &userId, &rsoName)
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "No pending request with this ID",
+		})
+		return
+	}
+
+	reviewer := sql.NullInt32{Int32: int32(user.UserID), Valid: true}
+	if review.Approve {
+		err = addRSOMember(db, rsoId, userId, requestId, reviewer)
+	} else {
+		query = `UPDATE public."RSO_Join_Requests" SET status = 'denied', reviewed_by = $1, date_reviewed = CURRENT_TIMESTAMP
+				WHERE request_id = $2`
+		_, err = db.Exec(query, reviewer, requestId)
+	}
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Error reviewing the request: " + err.Error(),
+		})
+		return
+	}
+
+	if review.Approve {
+		notifyUser(r, db, userId, "Welcome to "+rsoName, "Your request to join "+rsoName+" was approved.")
+	} else {
+		notifyUser(r, db, userId, "Your request to join "+rsoName, "Your request to join "+rsoName+" was declined.")
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "Request reviewed",
+	})
+}
+
+// Auth token required...
+// Officers invite a student of the RSO's university
+func InviteToRSO(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, ok := checkRSOOfficer(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	var form RsoInviteForm
+	err = json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "There was an error parsing the data",
+		})
+		return
+	}
+
+	var userId int
+	var rsoName string
+	query := `SELECT u.user_id, r.name FROM public."Users" u
+			JOIN public."RSOs" r ON r.uni_id = u.uni_id
+			WHERE u.username = $1 AND r.rso_id = $2 AND r.archived_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM public."User_RSO_Membership" m WHERE m.user_id = u.user_id AND m.rso_id = r.rso_id)`
+	err = db.QueryRow(query, form.Username, rsoId).Scan(&userId, &rsoName)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Only students of the RSO's university who are not members yet can be invited",
+		})
+		return
+	}
+
+	// The inviting officer is kept in reviewed_by
+	query = `INSERT INTO public."RSO_Join_Requests" (rso_id, user_id, kind, reviewed_by)
+			VALUES ($1, $2, 'invite', $3)
+			ON CONFLICT (rso_id, user_id) WHERE status = 'pending' DO NOTHING`
+	result, err := db.Exec(query, rsoId, userId, user.UserID)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "This user already has a pending request or invitation",
+		})
+		return
+	}
+
+	notifyUser(r, db, userId, "You are invited to join "+rsoName,
+		user.UserName+" invited you to join "+rsoName+".")
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "Invitation sent",
+	})
+}
+
+// Auth token required...
+// The invited user accepts or declines
+func RespondRSOInvite(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	var response RsoInviteResponse
+	err = json.NewDecoder(r.Body).Decode(&response)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "There was an error parsing the data",
+		})
+		return
+	}
+
+	var requestId, rsoId int
+	query := `SELECT request_id, rso_id FROM public."RSO_Join_Requests"
+			WHERE request_id = $1 AND user_id = $2 AND kind = 'invite' AND status = 'pending'`
+	err = db.QueryRow(query, chi.URLParam(r, "requestId"), user.UserID).Scan(&requestId, &rsoId)
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "No pending invitation with this ID",
+		})
+		return
+	}
+
+	if response.Accept {
+		err = addRSOMember(db, rsoId, user.UserID, requestId, sql.NullInt32{})
+	} else {
+		query = `UPDATE public."RSO_Join_Requests" SET status = 'denied', date_reviewed = CURRENT_TIMESTAMP
+				WHERE request_id = $1`
+		_, err = db.Exec(query, requestId)
+	}
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Error responding to the invitation: " + err.Error(),
+		})
+		return
+	}
+
+	message := "Invitation declined"
+	if response.Accept {
+		message = "You joined the RSO"
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": message,
+	})
+}
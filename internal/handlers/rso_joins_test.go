@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bingKegeta/Knight-Link/internal/notify"
+)
+
+// Keeps the messages instead of sending them
+type recordingNotifier struct {
+	mu       sync.Mutex
+	messages []notify.Message
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, msg notify.Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.messages = append(n.messages, msg)
+	return nil
+}
+
+// The officers hear about a request to join an RSO that approves its members
+func TestJoinRequestNotifiesOfficers(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+	admin := f.addUser(t, db, "admin", f.uniId, "student")
+	rsoId := f.addRSO(t, db, "approving", f.uniId, admin)
+
+	_, err := db.Exec(`UPDATE public."Users" SET email = $1 WHERE user_id = $2`, "admin"+f.suffix+"@example.com", admin.UserID)
+	if err == nil {
+		_, err = db.Exec(`UPDATE public."RSOs" SET join_policy = 'approval' WHERE rso_id = $1`, rsoId)
+	}
+	if err != nil {
+		t.Fatalf("setting up the RSO: %v", err)
+	}
+
+	recorder := &recordingNotifier{}
+	SetNotifier(recorder)
+	t.Cleanup(func() { SetNotifier(notify.LogNotifier{}) })
+
+	body := strings.NewReader(`{"rso_name": "Test approving ` + f.suffix + `", "message": "Let me in"}`)
+	r := asUser(t, httptest.NewRequest(http.MethodPost, "/join", body), f.student.UserName)
+	w := httptest.NewRecorder()
+	JoinRSO(w, r)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if len(recorder.messages) != 1 || recorder.messages[0].To != "admin"+f.suffix+"@example.com" ||
+		!strings.Contains(recorder.messages[0].Body, "Let me in") {
+		t.Errorf("sent %+v, want the request to the admin", recorder.messages)
+	}
+}
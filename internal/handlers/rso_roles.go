@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+type RoleForm struct {
+	Role string `json:"role"`
+}
+
+type TransferForm struct {
+	Username string `json:"username"`
+}
+
+type TransferResponse struct {
+	Accept bool `json:"accept"`
+}
+
+var errNoTransfer = errors.New("no pending admin transfer for you")
+
+// The user's role in the RSO, empty when not a member
+func rsoRole(db *sql.DB, userId int, rsoId int) (string, error) {
+	var role string
+	query := `SELECT role FROM public."User_RSO_Membership" WHERE user_id = $1 AND rso_id = $2`
+	err := db.QueryRow(query, userId, rsoId).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return role, err
+}
+
+// Officers and the admin can act on behalf of the RSO, e.g. create events
+func isRSOOfficer(db *sql.DB, userId int, rsoId int) (bool, error) {
+	role, err := rsoRole(db, userId, rsoId)
+	return role == "officer" || role == "admin", err
+}
+
+// Parses the RSO in the URL and checks the user is its admin. Writes the
+// error response itself and returns false when the request should stop.
+func checkRSOAdmin(db *sql.DB, w http.ResponseWriter, r *http.Request, user SessionUser) (int, bool) {
+	rsoId, err := strconv.Atoi(chi.URLParam(r, "rsoId"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid RSO ID",
+		})
+		return 0, false
+	}
+
+	admin, err := isRSOAdmin(db, user.UserID, rsoId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return 0, false
+	}
+
+	if !admin {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Only the RSO admin can do this",
+		})
+		return 0, false
+	}
+
+	return rsoId, true
+}
+
+// Auth token required...
+// The admin makes a member an officer or back to a plain member
+func SetMemberRole(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, ok := checkRSOAdmin(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	var form RoleForm
+	err = json.NewDecoder(r.Body).Decode(&form)
+	if err != nil || (form.Role != "member" && form.Role != "officer") {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "role must be member or officer, use an admin transfer to change the admin",
+		})
+		return
+	}
+
+	// The admin's own row only changes through a transfer
+	query := `UPDATE public."User_RSO_Membership" m SET role = $1
+			FROM public."Users" u
+			WHERE u.user_id = m.user_id AND u.username = $2 AND m.rso_id = $3 AND m.role <> 'admin'`
+	result, err := db.Exec(query, form.Role, chi.URLParam(r, "username"), rsoId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "This user is not a member of the RSO",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "Role updated",
+	})
+}
+
+// Auth token required...
+// The admin offers the RSO to another member, who has to accept it
+func RequestAdminTransfer(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, ok := checkRSOAdmin(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	var form TransferForm
+	err = json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "There was an error parsing the data",
+		})
+		return
+	}
+
+	var targetId int
+	query := `SELECT u.user_id FROM public."Users" u
+			JOIN public."User_RSO_Membership" m ON m.user_id = u.user_id
+			WHERE u.username = $1 AND m.rso_id = $2 AND u.user_id <> $3`
+	err = db.QueryRow(query, form.Username, rsoId, user.UserID).Scan(&targetId)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "The new admin must be another member of the RSO",
+		})
+		return
+	}
+
+	// One transfer at a time, a new request replaces the old one
+	query = `INSERT INTO public."RSO_Admin_Transfers" (rso_id, from_user, to_user) VALUES ($1, $2, $3)
+			ON CONFLICT (rso_id) DO UPDATE SET from_user = EXCLUDED.from_user, to_user = EXCLUDED.to_user,
+			date_requested = CURRENT_TIMESTAMP`
+	_, err = db.Exec(query, rsoId, user.UserID, targetId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "Transfer requested, waiting for " + form.Username + " to accept",
+	})
+}
+
+// Auth token required...
+func CancelAdminTransfer(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, ok := checkRSOAdmin(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	_, err = db.Exec(`DELETE FROM public."RSO_Admin_Transfers" WHERE rso_id = $1`, rsoId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "Transfer cancelled",
+	})
+}
+
+// Hands the RSO over: roles, admin_id and user_type change together. The old
+// admin stays on as an officer and is demoted if they run no other RSO.
+func acceptAdminTransfer(db *sql.DB, rsoId int, userId int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var fromUser int
+	query := `DELETE FROM public."RSO_Admin_Transfers" WHERE rso_id = $1 AND to_user = $2 RETURNING from_user`
+	err = tx.QueryRow(query, rsoId, userId).Scan(&fromUser)
+	if err == sql.ErrNoRows {
+		return errNoTransfer
+	}
+	if err != nil {
+		return err
+	}
+
+	// The admin could have changed since the request was made
+	result, err := tx.Exec(`UPDATE public."RSOs" SET admin_id = $1 WHERE rso_id = $2 AND admin_id = $3`, userId, rsoId, fromUser)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errNoTransfer
+	}
+
+	// one_rso_admin is checked row by row, so the old admin steps down before
+	// the new one steps up
+	query = `UPDATE public."User_RSO_Membership" SET role = 'officer' WHERE rso_id = $1 AND user_id = $2`
+	if _, err = tx.Exec(query, rsoId, fromUser); err != nil {
+		return err
+	}
+
+	query = `UPDATE public."User_RSO_Membership" SET role = 'admin' WHERE rso_id = $1 AND user_id = $2`
+	if _, err = tx.Exec(query, rsoId, userId); err != nil {
+		return err
+	}
+
+	// Membership is in place, so validate_admin_association lets this through
+	_, err = tx.Exec(`UPDATE public."Users" SET user_type = 'admin' WHERE user_id = $1 AND user_type = 'student'`, userId)
+	if err != nil {
+		return err
+	}
+
+	if err = demoteIfNoRSO(tx, fromUser); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Auth token required...
+// The member offered the RSO accepts or declines
+func RespondAdminTransfer(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, err := strconv.Atoi(chi.URLParam(r, "rsoId"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid RSO ID",
+		})
+		return
+	}
+
+	var response TransferResponse
+	err = json.NewDecoder(r.Body).Decode(&response)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "There was an error parsing the data",
+		})
+		return
+	}
+
+	if !response.Accept {
+		result, err := db.Exec(`DELETE FROM public."RSO_Admin_Transfers" WHERE rso_id = $1 AND to_user = $2`, rsoId, user.UserID)
+		if err == nil {
+			if n, _ := result.RowsAffected(); n == 0 {
+				err = errNoTransfer
+			}
+		}
+		if err != nil {
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "success",
+			"message": "Transfer declined",
+		})
+		return
+	}
+
+	err = acceptAdminTransfer(db, rsoId, user.UserID)
+	if err != nil {
+		if errors.Is(err, errNoTransfer) {
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": err.Error(),
+			})
+			return
+		}
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Error transferring the RSO: " + err.Error(),
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "You are now the admin of the RSO",
+	})
+}
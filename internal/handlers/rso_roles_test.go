@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// The admin is swapped within one_rso_admin, which allows a single admin
+func TestAcceptAdminTransfer(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+	rsoId := f.addRSO(t, db, "club", f.uniId, f.student)
+	member := f.addUser(t, db, "member", f.uniId, "student")
+
+	_, err := db.Exec(`INSERT INTO public."User_RSO_Membership" (user_id, rso_id, role) VALUES ($1, $2, 'member')`, member.UserID, rsoId)
+	if err != nil {
+		t.Fatalf("adding the member: %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO public."RSO_Admin_Transfers" (rso_id, from_user, to_user) VALUES ($1, $2, $3)`,
+		rsoId, f.student.UserID, member.UserID)
+	if err != nil {
+		t.Fatalf("requesting the transfer: %v", err)
+	}
+
+	if err = acceptAdminTransfer(db, rsoId, member.UserID); err != nil {
+		t.Fatalf("accepting the transfer: %v", err)
+	}
+
+	roles := map[int]string{f.student.UserID: "officer", member.UserID: "admin"}
+	for userId, want := range roles {
+		var role string
+		query := `SELECT role FROM public."User_RSO_Membership" WHERE user_id = $1 AND rso_id = $2`
+		if err = db.QueryRow(query, userId, rsoId).Scan(&role); err != nil {
+			t.Fatalf("reading the role of %d: %v", userId, err)
+		}
+		if role != want {
+			t.Errorf("user %d is %s, want %s", userId, role, want)
+		}
+	}
+}
+
+// Leaving takes the user from the token, whatever username the body names
+func TestLeaveRSOOnlyRemovesCaller(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+	rsoId := f.addRSO(t, db, "leaving", f.uniId, f.student)
+	member := f.addUser(t, db, "member", f.uniId, "student")
+	officer := f.addUser(t, db, "officer", f.uniId, "student")
+
+	query := `INSERT INTO public."User_RSO_Membership" (user_id, rso_id, role) VALUES ($1, $2, 'member'), ($3, $2, 'officer')`
+	if _, err := db.Exec(query, member.UserID, rsoId, officer.UserID); err != nil {
+		t.Fatalf("adding the members: %v", err)
+	}
+
+	body := `{"rso_name": "Test leaving ` + f.suffix + `", "username": "` + officer.UserName + `"}`
+
+	w := httptest.NewRecorder()
+	LeaveRSO(w, httptest.NewRequest(http.MethodPut, "/leave", strings.NewReader(body)))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("without a token: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	w = httptest.NewRecorder()
+	LeaveRSO(w, asUser(t, httptest.NewRequest(http.MethodPut, "/leave", strings.NewReader(body)), member.UserName))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, tt := range []struct {
+		user SessionUser
+		want bool
+	}{{member, false}, {officer, true}} {
+		var still bool
+		query = `SELECT EXISTS(SELECT 1 FROM public."User_RSO_Membership" WHERE user_id = $1 AND rso_id = $2)`
+		if err := db.QueryRow(query, tt.user.UserID, rsoId).Scan(&still); err != nil {
+			t.Fatalf("reading the membership: %v", err)
+		}
+		if still != tt.want {
+			t.Errorf("%s still a member: %v, want %v", tt.user.UserName, still, tt.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/render"
+
+	"github.com/bingKegeta/Knight-Link/internal/notify"
+)
+
+type RsoThresholdForm struct {
+	MinMembers int `json:"min_rso_members"`
+}
+
+// Runs a change to the members of an RSO in a transaction. The active flag
+// itself is kept by the refresh_rso_active trigger, this only locks the RSO
+// so concurrent joins and leaves see each other, and tells the admin when
+// the RSO drops below its university's threshold.
+func changeMembership(db *sql.DB, rsoId int, change func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var wasActive bool
+	err = tx.QueryRow(`SELECT active FROM public."RSOs" WHERE rso_id = $1 FOR UPDATE`, rsoId).Scan(&wasActive)
+	if err != nil {
+		return err
+	}
+
+	if err = change(tx); err != nil {
+		return err
+	}
+
+	var isActive bool
+	err = tx.QueryRow(`SELECT active FROM public."RSOs" WHERE rso_id = $1`, rsoId).Scan(&isActive)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	if wasActive && !isActive {
+		notifyRSOInactive(context.Background(), db, rsoId)
+	}
+
+	return nil
+}
+
+func notifyRSOInactive(ctx context.Context, db *sql.DB, rsoId int) {
+	var name string
+	var email sql.NullString
+	var members, threshold int
+	query := `SELECT r.name, a.email, (SELECT COUNT(*) FROM public."User_RSO_Membership" m WHERE m.rso_id = r.rso_id), u.min_rso_members
+			FROM public."RSOs" r
+			JOIN public."Universities" u ON u.uni_id = r.uni_id
+			LEFT JOIN public."Users" a ON a.user_id = r.admin_id
+			WHERE r.rso_id = $1`
+	err := db.QueryRow(query, rsoId).Scan(&name, &email, &members, &threshold)
+	if err != nil || email.String == "" {
+		log.Printf("Could not notify the admin of RSO %d about it becoming inactive: %v", rsoId, err)
+		return
+	}
+
+	err = notifier.Notify(ctx, notify.Message{
+		To:      email.String,
+		Subject: name + " is now inactive",
+		Body: fmt.Sprintf("%s has %d members, below the %d your university requires. "+
+			"It cannot host RSO events until it has enough members again.", name, members, threshold),
+	})
+	if err != nil {
+		log.Printf("Error notifying the admin of RSO %d: %v", rsoId, err)
+	}
+}
+
+// Auth token required...
+// Superadmins set how many members an RSO needs to be active
+func UpdateRSOThreshold(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	uniId, ok := checkUniSuperadmin(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	var form RsoThresholdForm
+	err = json.NewDecoder(r.Body).Decode(&form)
+	if err != nil || form.MinMembers < 1 {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "min_rso_members must be at least 1",
+		})
+		return
+	}
+
+	// Remember which RSOs were active to tell the admins of those that drop out
+	var wereActive []int
+	rows, err := db.Query(`SELECT rso_id FROM public."RSOs" WHERE uni_id = $1 AND active`, uniId)
+	if err == nil {
+		for rows.Next() {
+			var rsoId int
+			if rows.Scan(&rsoId) == nil {
+				wereActive = append(wereActive, rsoId)
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+	}
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting RSOs",
+		})
+		return
+	}
+
+	// The update_rso_active_threshold trigger refreshes every RSO of the university
+	result, err := db.Exec(`UPDATE public."Universities" SET min_rso_members = $1 WHERE uni_id = $2`,
+		form.MinMembers, uniId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "University not found",
+		})
+		return
+	}
+
+	for _, rsoId := range wereActive {
+		var active bool
+		err = db.QueryRow(`SELECT active FROM public."RSOs" WHERE rso_id = $1`, rsoId).Scan(&active)
+		if err == nil && !active {
+			notifyRSOInactive(r.Context(), db, rsoId)
+		}
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "RSO threshold updated",
+	})
+}
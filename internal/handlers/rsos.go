@@ -0,0 +1,519 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/lib/pq"
+)
+
+type RsoEvent struct {
+	EventId int    `json:"event_id"`
+	Name    string `json:"event_name"`
+	EventTimes
+	Status string `json:"status"`
+}
+
+type RsoDetail struct {
+	RsoId          int            `json:"rso_id"`
+	Name           string         `json:"rso_name"`
+	Description    sql.NullString `json:"description"`
+	Admin          sql.NullString `json:"admin"`
+	UniId          int            `json:"uni_id"`
+	UniversityName string         `json:"uni_name"`
+	MemberCount    int            `json:"member_count"`
+	Active         bool           `json:"active"`
+	JoinPolicy     string         `json:"join_policy"`
+	Categories     []string       `json:"categories"`
+	LogoURL        *string        `json:"logo_url"`
+	DateCreated    string         `json:"date_created"`
+	UpcomingEvents []RsoEvent     `json:"upcoming_events"`
+}
+
+// Fields left out are not changed
+type RsoUpdateForm struct {
+	Name        *string `json:"rso_name"`
+	Description *string `json:"description"`
+	// open, approval or invite_only
+	JoinPolicy *string   `json:"join_policy"`
+	Categories *[]string `json:"categories"`
+}
+
+// What to do with the events of a deleted RSO: "cancel" (default) cancels the
+// upcoming ones, "rehome" moves them all to target_rso and "archive" keeps
+// the RSO around, hidden, so its events keep pointing at it.
+type RsoDeleteForm struct {
+	Events    string `json:"events"`
+	TargetRso string `json:"target_rso"`
+}
+
+// Whether the user can manage the RSO: its admin or a superadmin of its
+// university
+func canManageRSO(db *sql.DB, user SessionUser, rsoId int) (bool, error) {
+	superadmin, err := isSuperadminOfRSO(db, user, rsoId)
+	if err != nil || superadmin {
+		return superadmin, err
+	}
+	return isRSOAdmin(db, user.UserID, rsoId)
+}
+
+// Demotes the user back to student once they no longer run any RSO
+func demoteIfNoRSO(tx *sql.Tx, userId int) error {
+	query := `UPDATE public."Users" SET user_type = 'student'
+			WHERE user_id = $1 AND user_type = 'admin'
+			AND NOT EXISTS (SELECT 1 FROM public."RSOs" WHERE admin_id = $1 AND archived_at IS NULL)`
+	_, err := tx.Exec(query, userId)
+	return err
+}
+
+// Auth token required...
+func GetRSO(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	tx, err := BeginUserTx(db, user)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var rso RsoDetail
+	var logo sql.NullInt32
+	query := `SELECT r.rso_id, r.name, r.description, a.username, r.uni_id, u.name, r.date_created, r.active, r.join_policy, r.categories, r.logo_id,
+			(SELECT COUNT(*) FROM public."User_RSO_Membership" m WHERE m.rso_id = r.rso_id)
+			FROM public."RSOs" r
+			JOIN public."Universities" u ON u.uni_id = r.uni_id
+			LEFT JOIN public."Users" a ON a.user_id = r.admin_id
+			WHERE r.rso_id = $1 AND r.archived_at IS NULL`
+	err = tx.QueryRow(query, chi.URLParam(r, "rsoId")).Scan(&rso.RsoId, &rso.Name, &rso.Description, &rso.Admin,
+		&rso.UniId, &rso.UniversityName, &rso.DateCreated, &rso.Active, &rso.JoinPolicy, pq.Array(&rso.Categories), &logo, &rso.MemberCount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "RSO not found",
+			})
+			return
+		}
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+	rso.LogoURL = mediaURL(logo)
+
+	// Only the upcoming events the viewer is allowed to see
+	query = `SELECT e.event_id, e.name, e.start_time, e.end_time, e.time_zone, e.status
+			FROM public."Events" e
+			WHERE e.rso_id = $2 AND e.end_time > CURRENT_TIMESTAMP AND e.status IN ('scheduled', 'postponed')
+			AND ` + visibleEventClause + `
+			ORDER BY e.start_time`
+
+	rows, err := tx.Query(query, user.UserID, rso.RsoId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting Events",
+		})
+		return
+	}
+	defer rows.Close()
+
+	rso.UpcomingEvents = []RsoEvent{}
+
+	for rows.Next() {
+		var event RsoEvent
+		var start, end time.Time
+		var zone string
+		err = rows.Scan(&event.EventId, &event.Name, &start, &end, &zone, &event.Status)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Error getting Events array",
+			})
+			return
+		}
+		event.EventTimes = newEventTimes(start, end, zone)
+		rso.UpcomingEvents = append(rso.UpcomingEvents, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error iterating over rows",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data":   rso,
+	})
+}
+
+// Auth token required...
+func UpdateRSO(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, err := strconv.Atoi(chi.URLParam(r, "rsoId"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid RSO ID",
+		})
+		return
+	}
+
+	var form RsoUpdateForm
+	err = json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "There was an error parsing the data",
+		})
+		return
+	}
+
+	if form.Name != nil && strings.TrimSpace(*form.Name) == "" {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "The RSO name cannot be empty",
+		})
+		return
+	}
+
+	if form.JoinPolicy != nil && !validJoinPolicy(*form.JoinPolicy) {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "join_policy must be one of open, approval or invite_only",
+		})
+		return
+	}
+
+	var categories interface{}
+	if form.Categories != nil {
+		if err = validateCategories(*form.Categories); err != nil {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": err.Error(),
+			})
+			return
+		}
+		categories = pq.Array(*form.Categories)
+	}
+
+	allowed, err := canManageRSO(db, user, rsoId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if !allowed {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Only the RSO admin or a superadmin can update the RSO",
+		})
+		return
+	}
+
+	query := `UPDATE public."RSOs" SET name = COALESCE($1, name), description = COALESCE($2, description),
+			join_policy = COALESCE($3::public.rso_join_policy, join_policy),
+			categories = COALESCE($4::public.categories[], categories)
+			WHERE rso_id = $5 AND archived_at IS NULL`
+	result, err := db.Exec(query, form.Name, form.Description, form.JoinPolicy, categories, rsoId)
+	if err != nil {
+		if pgerr, ok := err.(*pq.Error); ok && pgerr.Code == "23505" {
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "error",
+				"message": "An RSO with this name already exists",
+			})
+			return
+		}
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "RSO not found",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "RSO updated",
+	})
+}
+
+// Auth token required...
+func DeleteRSO(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	rsoId, err := strconv.Atoi(chi.URLParam(r, "rsoId"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid RSO ID",
+		})
+		return
+	}
+
+	// The body is optional, events are cancelled by default
+	var form RsoDeleteForm
+	_ = json.NewDecoder(r.Body).Decode(&form)
+	if form.Events == "" {
+		form.Events = "cancel"
+	}
+
+	if form.Events != "cancel" && form.Events != "rehome" && form.Events != "archive" {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "events must be one of cancel, rehome or archive",
+		})
+		return
+	}
+
+	allowed, err := canManageRSO(db, user, rsoId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if !allowed {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Only the RSO admin or a superadmin can delete the RSO",
+		})
+		return
+	}
+
+	var rsoName string
+	var uniId int
+	var adminId sql.NullInt32
+	query := `SELECT name, uni_id, admin_id FROM public."RSOs" WHERE rso_id = $1 AND archived_at IS NULL`
+	err = db.QueryRow(query, rsoId).Scan(&rsoName, &uniId, &adminId)
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "RSO not found",
+		})
+		return
+	}
+
+	// Events can only move to another RSO of the same university that the
+	// user is allowed to manage as well
+	var targetId int
+	if form.Events == "rehome" {
+		query = `SELECT rso_id FROM public."RSOs" WHERE name = $1 AND uni_id = $2 AND rso_id <> $3 AND archived_at IS NULL`
+		err = db.QueryRow(query, form.TargetRso, uniId, rsoId).Scan(&targetId)
+		if err != nil {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "target_rso must be another RSO of the same university",
+			})
+			return
+		}
+
+		allowed, err = canManageRSO(db, user, targetId)
+		if err != nil || !allowed {
+			render.Status(r, http.StatusForbidden)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "You must also manage the RSO the events move to",
+			})
+			return
+		}
+	}
+
+	// Cancelling goes through the event lifecycle so attendees hear about it,
+	// once the deletion went through
+	reason := rsoName + " no longer exists"
+	cancelled, err := deleteRSO(db, rsoId, targetId, form.Events, adminId,
+		sql.NullInt32{Int32: int32(user.UserID), Valid: true}, reason)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Error deleting the RSO: " + err.Error(),
+		})
+		return
+	}
+
+	for eventId, eventName := range cancelled {
+		subject, body := statusMessage(eventName, "cancelled", reason)
+		notifyAttendees(context.Background(), db, eventId, subject, body)
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "RSO deleted",
+	})
+}
+
+// Removes (or archives) the RSO and its memberships and demotes the admin if
+// this was their last RSO, all in one transaction. In cancel mode its
+// upcoming events are cancelled for the reason given and returned, id to
+// name, for the caller to tell their attendees after the commit.
+func deleteRSO(db *sql.DB, rsoId int, targetId int, mode string, adminId sql.NullInt32,
+	changedBy sql.NullInt32, reason string) (map[int]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	cancelled := map[int]string{}
+	if mode == "cancel" {
+		query := `SELECT event_id, name FROM public."Events" WHERE rso_id = $1 AND status IN ('scheduled', 'postponed')`
+		rows, err := tx.Query(query, rsoId)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var eventId int
+			var name string
+			if err = rows.Scan(&eventId, &name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			cancelled[eventId] = name
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+
+		for eventId := range cancelled {
+			if _, err = changeEventStatusTx(tx, eventId, "cancelled", reason, changedBy, nil, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if mode == "rehome" {
+		// Skip hosting rows the target already has, the delete below drops them
+		query := `UPDATE public."Event_Hosts" h SET rso_id = $1
+				WHERE h.rso_id = $2 AND NOT EXISTS (
+					SELECT 1 FROM public."Event_Hosts" t WHERE t.event_id = h.event_id AND t.rso_id = $1)`
+		if _, err = tx.Exec(query, targetId, rsoId); err != nil {
+			return nil, err
+		}
+
+		if _, err = tx.Exec(`UPDATE public."Events" SET rso_id = $1 WHERE rso_id = $2`, targetId, rsoId); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err = tx.Exec(`DELETE FROM public."User_RSO_Membership" WHERE rso_id = $1`, rsoId); err != nil {
+		return nil, err
+	}
+
+	if mode == "archive" {
+		_, err = tx.Exec(`UPDATE public."RSOs" SET archived_at = CURRENT_TIMESTAMP WHERE rso_id = $1`, rsoId)
+	} else {
+		_, err = tx.Exec(`DELETE FROM public."RSOs" WHERE rso_id = $1`, rsoId)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if adminId.Valid {
+		if err = demoteIfNoRSO(tx, int(adminId.Int32)); err != nil {
+			return nil, err
+		}
+	}
+
+	return cancelled, tx.Commit()
+}
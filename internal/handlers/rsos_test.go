@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// The events of a deleted RSO are cancelled in the same transaction
+func TestDeleteRSOCancelsEvents(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+	rsoId := f.addRSO(t, db, "closing", f.uniId, f.student)
+	eventId := f.addEvent(t, db, "closing", 4*time.Hour, "public", f.uniId, rsoId, nil)
+
+	by := sql.NullInt32{Int32: int32(f.student.UserID), Valid: true}
+	cancelled, err := deleteRSO(db, rsoId, 0, "cancel", sql.NullInt32{}, by, "gone")
+	if err != nil {
+		t.Fatalf("deleting the RSO: %v", err)
+	}
+	if name := cancelled[eventId]; name != "Test closing "+f.suffix || len(cancelled) != 1 {
+		t.Errorf("cancelled %v, want only event %d", cancelled, eventId)
+	}
+
+	var status string
+	if err = db.QueryRow(`SELECT status FROM public."Events" WHERE event_id = $1`, eventId).Scan(&status); err != nil {
+		t.Fatalf("reading the event: %v", err)
+	}
+	if status != "cancelled" {
+		t.Errorf("event is %s, want cancelled", status)
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/jwtauth"
+)
+
+// The user behind the token of an authenticated request
+type SessionUser struct {
+	UserID   int
+	UserName string
+	UniId    int
+	UserType string
+	// Superadmin of every university rather than of the assigned ones
+	PlatformAdmin bool
+}
+
+var errNoSession = errors.New("no username in token")
+
+// Reads the username out of the verified token and looks the user up.
+// Only works on routes behind jwtauth.Verifier.
+func currentUser(db *sql.DB, r *http.Request) (SessionUser, error) {
+	var user SessionUser
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return user, err
+	}
+
+	username, ok := claims["username"].(string)
+	if !ok || username == "" {
+		return user, errNoSession
+	}
+
+	return lookupUser(db, username)
+}
+
+func lookupUser(db *sql.DB, username string) (SessionUser, error) {
+	var user SessionUser
+	query := `SELECT user_id, username, uni_id, user_type, platform_admin FROM public."Users" WHERE username = $1`
+	err := db.QueryRow(query, username).Scan(&user.UserID, &user.UserName, &user.UniId, &user.UserType, &user.PlatformAdmin)
+
+	return user, err
+}
+
+// Whether the user is the admin of the given RSO
+func isRSOAdmin(db *sql.DB, userId int, rsoId int) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM public."RSOs" WHERE rso_id = $1 AND admin_id = $2)`
+	err := db.QueryRow(query, rsoId, userId).Scan(&exists)
+
+	return exists, err
+}
+
+// Whether the user is a superadmin assigned to the university, or the
+// platform superadmin
+func isSuperadminOf(db *sql.DB, user SessionUser, uniId int) (bool, error) {
+	if user.UserType != "superadmin" {
+		return false, nil
+	}
+	if user.PlatformAdmin {
+		return true, nil
+	}
+
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM public."Superadmin_Universities" WHERE user_id = $1 AND uni_id = $2)`
+	err := db.QueryRow(query, user.UserID, uniId).Scan(&exists)
+
+	return exists, err
+}
+
+// Whether the user is a superadmin of the university the RSO belongs to
+func isSuperadminOfRSO(db *sql.DB, user SessionUser, rsoId int) (bool, error) {
+	if user.UserType != "superadmin" {
+		return false, nil
+	}
+
+	var uniId int
+	err := db.QueryRow(`SELECT uni_id FROM public."RSOs" WHERE rso_id = $1`, rsoId).Scan(&uniId)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return isSuperadminOf(db, user, uniId)
+}
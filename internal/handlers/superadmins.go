@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type SuperadminForm struct {
+	UserName string `json:"username"`
+}
+
+type UniSuperadmin struct {
+	UserName     string         `json:"username"`
+	FirstName    sql.NullString `json:"first_name"`
+	LastName     sql.NullString `json:"last_name"`
+	Email        sql.NullString `json:"email"`
+	AssignedBy   sql.NullString `json:"assigned_by"`
+	DateAssigned time.Time      `json:"date_assigned"`
+}
+
+var errNotAssigned = errors.New("the user is not a superadmin of this university")
+
+// Creates the platform superadmin, and their university when it does not
+// exist yet. An existing user is promoted and keeps their password. Used by
+// the superadmin command of the server binary.
+func BootstrapSuperadmin(username string, email string, password string, university string) error {
+	username = strings.TrimSpace(username)
+	university = strings.TrimSpace(university)
+	if username == "" || university == "" {
+		return errors.New("a username and a university are required")
+	}
+
+	db, err := connectToDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var uniId int
+	query := `INSERT INTO public."Universities" (name) VALUES ($1)
+			ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name RETURNING uni_id`
+	if err = tx.QueryRow(query, university).Scan(&uniId); err != nil {
+		return err
+	}
+
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM public."Users" WHERE username = $1)`, username).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		_, err = tx.Exec(`UPDATE public."Users" SET user_type = 'superadmin', platform_admin = true WHERE username = $1`,
+			username)
+	} else {
+		if password == "" {
+			return errors.New("a password is required to create the user")
+		}
+
+		var hashed []byte
+		hashed, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+
+		query = `INSERT INTO public."Users" (username, "password", email, uni_id, user_type, platform_admin)
+				VALUES ($1, $2, NULLIF($3, ''), $4, 'superadmin', true)`
+		_, err = tx.Exec(query, username, string(hashed), email, uniId)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Auth token required...
+// The superadmins assigned to the university
+func GetUniSuperadmins(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	uniId, ok := checkUniSuperadmin(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	query := `SELECT u.username, u.first_name, u.last_name, u.email, a.username, s.date_assigned
+			FROM public."Superadmin_Universities" s
+			JOIN public."Users" u ON u.user_id = s.user_id
+			LEFT JOIN public."Users" a ON a.user_id = s.assigned_by
+			WHERE s.uni_id = $1
+			ORDER BY s.date_assigned`
+	rows, err := db.Query(query, uniId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting superadmins",
+		})
+		return
+	}
+	defer rows.Close()
+
+	superadmins := []UniSuperadmin{}
+	for rows.Next() {
+		var s UniSuperadmin
+		err = rows.Scan(&s.UserName, &s.FirstName, &s.LastName, &s.Email, &s.AssignedBy, &s.DateAssigned)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Error scanning superadmins",
+			})
+			return
+		}
+		superadmins = append(superadmins, s)
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data":   superadmins,
+	})
+}
+
+// Auth token required...
+// The platform superadmin makes a user a superadmin of the university
+func AssignSuperadmin(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	if !requirePlatformAdmin(w, r, user) {
+		return
+	}
+
+	uniId, err := strconv.Atoi(chi.URLParam(r, "uni_id"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid university ID",
+		})
+		return
+	}
+
+	var form SuperadminForm
+	err = json.NewDecoder(r.Body).Decode(&form)
+	if err != nil || form.UserName == "" {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "A username is required",
+		})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM public."Universities" WHERE uni_id = $1 AND archived_at IS NULL)`,
+		uniId).Scan(&exists)
+	if err != nil || !exists {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "University not found",
+		})
+		return
+	}
+
+	var userId int
+	err = tx.QueryRow(`UPDATE public."Users" SET user_type = 'superadmin' WHERE username = $1 RETURNING user_id`,
+		form.UserName).Scan(&userId)
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "User not found",
+		})
+		return
+	}
+
+	query := `INSERT INTO public."Superadmin_Universities" (user_id, uni_id, assigned_by) VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING`
+	_, err = tx.Exec(query, userId, uniId, user.UserID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": form.UserName + " is now a superadmin of the university",
+	})
+}
+
+// Takes the university away from the superadmin. Without any university
+// left they go back to running their RSOs, or to being a student.
+func unassignSuperadmin(db *sql.DB, uniId int, username string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userId int
+	query := `DELETE FROM public."Superadmin_Universities" s USING public."Users" u
+			WHERE s.user_id = u.user_id AND s.uni_id = $1 AND u.username = $2 RETURNING s.user_id`
+	err = tx.QueryRow(query, uniId, username).Scan(&userId)
+	if err == sql.ErrNoRows {
+		return errNotAssigned
+	}
+	if err != nil {
+		return err
+	}
+
+	query = `UPDATE public."Users" SET user_type = CASE
+				WHEN EXISTS (SELECT 1 FROM public."User_RSO_Membership" WHERE user_id = $1 AND role = 'admin')
+				THEN 'admin'::public.auth ELSE 'student'::public.auth END
+			WHERE user_id = $1 AND user_type = 'superadmin' AND NOT platform_admin
+			AND NOT EXISTS (SELECT 1 FROM public."Superadmin_Universities" WHERE user_id = $1)`
+	if _, err = tx.Exec(query, userId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Auth token required...
+func UnassignSuperadmin(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	if !requirePlatformAdmin(w, r, user) {
+		return
+	}
+
+	uniId, err := strconv.Atoi(chi.URLParam(r, "uni_id"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid university ID",
+		})
+		return
+	}
+
+	err = unassignSuperadmin(db, uniId, chi.URLParam(r, "username"))
+	if err != nil {
+		if errors.Is(err, errNotAssigned) {
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": err.Error(),
+			})
+			return
+		}
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "Superadmin removed from the university",
+	})
+}
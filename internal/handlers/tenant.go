@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"database/sql"
+	"strconv"
+)
+
+// Role the scoped transactions run as. Unlike the owner of the tables it is
+// subject to the row-level security policies of setup.sql.
+const tenantRole = "knightlink_app"
+
+// Satisfied by both *sql.DB and *sql.Tx, for helpers that run either way
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Begins a transaction that runs as the restricted role with the user's id,
+// university and role as settings. The policies then only let it see what
+// the user may see, even when a query forgets to filter. The settings and
+// the role end with the transaction. Meant for reads: the triggers that look
+// across universities run as the same role and would only see its rows.
+//
+// Coverage is partial: only GetAllEvents, GetEvent, GetNearbyEvents,
+// GetUniMap, GetAllRSOs, GetRSO and GetRSOMembers read through it so far.
+// Every other handler still queries as the owner of the tables and relies
+// on its own WHERE clauses, visibleEventClause for events.
+func BeginUserTx(db *sql.DB, user SessionUser) (*sql.Tx, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT set_config('app.user_id', $1, true), set_config('app.uni_id', $2, true),
+			set_config('app.user_type', $3, true), set_config('app.platform_admin', $4, true)`
+	_, err = tx.Exec(query, strconv.Itoa(user.UserID), strconv.Itoa(user.UniId), user.UserType,
+		strconv.FormatBool(user.PlatformAdmin))
+	if err == nil {
+		_, err = tx.Exec(`SET LOCAL ROLE ` + tenantRole)
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return tx, nil
+}
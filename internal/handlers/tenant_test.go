@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// Counts the rows of an unscoped query run as the user
+func countAsUser(t *testing.T, db *sql.DB, user SessionUser, query string, args ...interface{}) int {
+	t.Helper()
+	tx, err := BeginUserTx(db, user)
+	if err != nil {
+		t.Fatalf("beginning the scoped transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var n int
+	if err = tx.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatalf("running %q: %v", query, err)
+	}
+	return n
+}
+
+// A user of one university must not read the private rows of another, even
+// with queries that filter nothing
+func TestRowLevelSecurity(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+
+	uniB := f.addUni(t, db, "Test U B")
+	alice := f.student
+	bob := f.addUser(t, db, "bob", uniB, "student")
+	sam := f.addUser(t, db, "sam", f.uniId, "superadmin")
+
+	_, err := db.Exec(`INSERT INTO public."Superadmin_Universities" (user_id, uni_id) VALUES ($1, $2)`, sam.UserID, uniB)
+	if err != nil {
+		t.Fatalf("assigning the superadmin: %v", err)
+	}
+
+	rsoB := f.addRSO(t, db, "club B", uniB, bob)
+	publicB := f.addEvent(t, db, "public B", 4*time.Hour, "public", uniB, nil, nil)
+	privateB := f.addEvent(t, db, "private B", 6*time.Hour, "private", uniB, nil, nil)
+	rsoEventB := f.addEvent(t, db, "RSO event B", 8*time.Hour, "rso_event", uniB, rsoB, nil)
+	privateA := f.addEvent(t, db, "private A", 10*time.Hour, "private", f.uniId, nil, nil)
+
+	query := `INSERT INTO public."Event_Feedback" (user_id, event_id, content, feedback_type) VALUES ($1, $2, 'secret', 'comment')`
+	if _, err = db.Exec(query, bob.UserID, privateB); err != nil {
+		t.Fatalf("adding feedback: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		user  SessionUser
+		query string
+		arg   int
+		want  int
+	}{
+		// A student of university A, with queries that forget every filter
+		{"alice sees no private events of B", alice, `SELECT COUNT(*) FROM public."Events" WHERE uni_id = $1 AND visibility <> 'public'`, uniB, 0},
+		{"alice sees the public event of B", alice, `SELECT COUNT(*) FROM public."Events" WHERE event_id = $1`, publicB, 1},
+		{"alice sees the private event of A", alice, `SELECT COUNT(*) FROM public."Events" WHERE event_id = $1`, privateA, 1},
+		{"alice sees no RSOs of B", alice, `SELECT COUNT(*) FROM public."RSOs" WHERE uni_id = $1`, uniB, 0},
+		{"alice sees no memberships of B", alice, `SELECT COUNT(*) FROM public."User_RSO_Membership" WHERE rso_id = $1`, rsoB, 0},
+		{"alice sees no feedback on private events of B", alice, `SELECT COUNT(*) FROM public."Event_Feedback" WHERE event_id = $1`, privateB, 0},
+		{"alice sees no users of B", alice, `SELECT COUNT(*) FROM public."Users" WHERE uni_id = $1`, uniB, 0},
+
+		// A member of B sees their own university
+		{"bob sees the event of their RSO", bob, `SELECT COUNT(*) FROM public."Events" WHERE event_id = $1`, rsoEventB, 1},
+		{"bob sees no private events of A", bob, `SELECT COUNT(*) FROM public."Events" WHERE event_id = $1`, privateA, 0},
+
+		// A superadmin of B sees B, whatever their own university
+		{"sam sees the RSOs of B", sam, `SELECT COUNT(*) FROM public."RSOs" WHERE uni_id = $1`, uniB, 1},
+		{"sam sees the feedback of B", sam, `SELECT COUNT(*) FROM public."Event_Feedback" WHERE event_id = $1`, privateB, 1},
+	}
+
+	for _, tt := range tests {
+		if got := countAsUser(t, db, tt.user, tt.query, tt.arg); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	// Rows the policies hide cannot be updated either
+	tx, err := BeginUserTx(db, alice)
+	if err != nil {
+		t.Fatalf("beginning the scoped transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE public."Events" SET name = 'taken over' WHERE event_id = $1`, privateB)
+	if err != nil {
+		t.Fatalf("running the update: %v", err)
+	}
+	if updated, _ := result.RowsAffected(); updated != 0 {
+		t.Errorf("alice updated %d private events of B", updated)
+	}
+}
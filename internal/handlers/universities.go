@@ -0,0 +1,455 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/lib/pq"
+)
+
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}$`)
+
+type UniForm struct {
+	Name         string   `json:"uni_name"`
+	Description  string   `json:"uni_description"`
+	TimeZone     string   `json:"time_zone"`
+	EmailDomains []string `json:"email_domains"`
+	Latitude     *float64 `json:"latitude"`
+	Longitude    *float64 `json:"longitude"`
+}
+
+// Fields left out are not changed. The coordinates change together, and an
+// empty description removes it.
+type UniUpdateForm struct {
+	Name         *string   `json:"uni_name"`
+	Description  *string   `json:"uni_description"`
+	TimeZone     *string   `json:"time_zone"`
+	EmailDomains *[]string `json:"email_domains"`
+	Latitude     *float64  `json:"latitude"`
+	Longitude    *float64  `json:"longitude"`
+}
+
+// Any address matches when the university has no domains
+func emailInDomains(email string, domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+
+	for _, d := range domains {
+		// Subdomains such as knights.ucf.edu count for ucf.edu
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lowercases the domains and checks they look like domains
+func normaliseDomains(domains []string) ([]string, error) {
+	normalised := make([]string, 0, len(domains))
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(d), "@")))
+		if !domainPattern.MatchString(d) {
+			return nil, errors.New("invalid email domain " + d)
+		}
+		normalised = append(normalised, d)
+	}
+	return normalised, nil
+}
+
+func validateCoordinates(lat *float64, lng *float64) error {
+	if (lat == nil) != (lng == nil) {
+		return errors.New("latitude and longitude go together")
+	}
+	// NaN passes every comparison, so it is ruled out first
+	if lat != nil && (math.IsNaN(*lat) || math.IsNaN(*lng) || math.IsInf(*lat, 0) || math.IsInf(*lng, 0) ||
+		*lat < -90 || *lat > 90 || *lng < -180 || *lng > 180) {
+		return errors.New("latitude must be within ±90 and longitude within ±180")
+	}
+	return nil
+}
+
+// Writes the error response itself and returns false unless the user is the
+// platform superadmin
+func requirePlatformAdmin(w http.ResponseWriter, r *http.Request, user SessionUser) bool {
+	if user.UserType == "superadmin" && user.PlatformAdmin {
+		return true
+	}
+
+	render.Status(r, http.StatusForbidden)
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "warning",
+		"message": "Only the platform superadmin can do this",
+	})
+	return false
+}
+
+// Parses the university in the URL and checks the user is one of its
+// superadmins. Writes the error response itself and returns false when the
+// request should stop.
+func checkUniSuperadmin(db *sql.DB, w http.ResponseWriter, r *http.Request, user SessionUser) (int, bool) {
+	uniId, err := strconv.Atoi(chi.URLParam(r, "uni_id"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid university ID",
+		})
+		return 0, false
+	}
+
+	allowed, err := isSuperadminOf(db, user, uniId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return 0, false
+	}
+
+	if !allowed {
+		render.Status(r, http.StatusForbidden)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Only superadmins of the university can do this",
+		})
+		return 0, false
+	}
+
+	return uniId, true
+}
+
+// Auth token required...
+func CreateUniversity(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	if !requirePlatformAdmin(w, r, user) {
+		return
+	}
+
+	var form UniForm
+	err = json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "There was an error parsing the data",
+		})
+		return
+	}
+
+	form.Name = strings.TrimSpace(form.Name)
+	if form.TimeZone == "" {
+		form.TimeZone = "UTC"
+	}
+
+	domains, err := normaliseDomains(form.EmailDomains)
+	if err == nil && form.Name == "" {
+		err = errors.New("the university needs a name")
+	}
+	if err == nil {
+		err = validateTimeZone(form.TimeZone)
+	}
+	if err == nil {
+		err = validateCoordinates(form.Latitude, form.Longitude)
+	}
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var uniId int
+	query := `INSERT INTO public."Universities" (name, description, time_zone, email_domains, latitude, longitude)
+			VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6) RETURNING uni_id`
+	err = db.QueryRow(query, form.Name, form.Description, form.TimeZone, pq.Array(domains), form.Latitude, form.Longitude).
+		Scan(&uniId)
+	if err != nil {
+		if pgerr, ok := err.(*pq.Error); ok && pgerr.Code == "23505" {
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "error",
+				"message": "A university with this name already exists",
+			})
+			return
+		}
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "University created",
+		"uni_id":  uniId,
+	})
+}
+
+// Auth token required...
+func UpdateUniDetails(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	uniId, ok := checkUniSuperadmin(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	var form UniUpdateForm
+	err = json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "There was an error parsing the data",
+		})
+		return
+	}
+
+	err = validateCoordinates(form.Latitude, form.Longitude)
+	if err == nil && form.Name != nil && strings.TrimSpace(*form.Name) == "" {
+		err = errors.New("the university name cannot be empty")
+	}
+	if err == nil && form.TimeZone != nil {
+		err = validateTimeZone(*form.TimeZone)
+	}
+
+	var domains interface{}
+	if err == nil && form.EmailDomains != nil {
+		var normalised []string
+		normalised, err = normaliseDomains(*form.EmailDomains)
+		domains = pq.Array(normalised)
+	}
+
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	query := `UPDATE public."Universities" SET name = COALESCE($1, name), description = CASE WHEN $2::text IS NULL THEN description ELSE NULLIF($2::text, '') END,
+			time_zone = COALESCE($3, time_zone), email_domains = COALESCE($4::varchar[], email_domains),
+			latitude = CASE WHEN $5 THEN $6 ELSE latitude END, longitude = CASE WHEN $5 THEN $7 ELSE longitude END
+			WHERE uni_id = $8 AND archived_at IS NULL`
+	result, err := db.Exec(query, form.Name, form.Description, form.TimeZone, domains,
+		form.Latitude != nil, form.Latitude, form.Longitude, uniId)
+	if err != nil {
+		if pgerr, ok := err.(*pq.Error); ok && pgerr.Code == "23505" {
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "error",
+				"message": "A university with this name already exists",
+			})
+			return
+		}
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "University not found",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "University updated",
+	})
+}
+
+// Auth token required...
+// Archived universities are hidden and take no new users. Their users, RSOs
+// and events stay as they are.
+func ArchiveUniversity(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	if !requirePlatformAdmin(w, r, user) {
+		return
+	}
+
+	uniId, err := strconv.Atoi(chi.URLParam(r, "uni_id"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Invalid university ID",
+		})
+		return
+	}
+
+	result, err := db.Exec(`UPDATE public."Universities" SET archived_at = CURRENT_TIMESTAMP WHERE uni_id = $1 AND archived_at IS NULL`,
+		uniId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "University not found",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status":  "success",
+		"message": "University archived",
+	})
+}
+
+// Auth token required...
+// The picture is a multipart form with a "file" field, like RSO logos
+func UploadUniPicture(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	uniId, ok := checkUniSuperadmin(db, w, r, user)
+	if !ok {
+		return
+	}
+
+	var oldPicture sql.NullInt32
+	err = db.QueryRow(`SELECT picture_id FROM public."Universities" WHERE uni_id = $1 AND archived_at IS NULL`, uniId).
+		Scan(&oldPicture)
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "University not found",
+		})
+		return
+	}
+
+	mediaId, status, err := saveImageUpload(w, r, db, user.UserID)
+	if err != nil {
+		render.Status(r, status)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	_, err = db.Exec(`UPDATE public."Universities" SET picture_id = $1 WHERE uni_id = $2`, mediaId, uniId)
+	if err != nil {
+		deleteMedia(r.Context(), db, mediaId)
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "error",
+			"message": "Database error: " + err.Error(),
+		})
+		return
+	}
+
+	if oldPicture.Valid {
+		deleteMedia(r.Context(), db, int(oldPicture.Int32))
+	}
+
+	render.Status(r, status)
+	render.JSON(w, r, map[string]interface{}{
+		"status":      "success",
+		"message":     "Picture uploaded",
+		"picture_url": mediaURL(sql.NullInt32{Int32: int32(mediaId), Valid: true}),
+	})
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+// Platform admin routes refuse ids that are not numbers, and an empty
+// description clears the one the university had
+func TestUniversityAdminRoutes(t *testing.T) {
+	db := testDB(t)
+	f := newFixture(t, db)
+	admin := f.addUser(t, db, "platform", f.uniId, "superadmin")
+	_, err := db.Exec(`UPDATE public."Users" SET platform_admin = true WHERE user_id = $1`, admin.UserID)
+	if err == nil {
+		_, err = db.Exec(`UPDATE public."Universities" SET description = 'Old' WHERE uni_id = $1`, f.uniId)
+	}
+	if err != nil {
+		t.Fatalf("preparing the platform admin: %v", err)
+	}
+
+	router := chi.NewRouter()
+	router.Put("/{uni_id}", UpdateUniDetails)
+	router.Delete("/{uni_id}", ArchiveUniversity)
+	router.Post("/{uni_id}/superadmins", AssignSuperadmin)
+	router.Delete("/{uni_id}/superadmins/{username}", UnassignSuperadmin)
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+		code   int
+	}{
+		{http.MethodDelete, "/abc", "", http.StatusBadRequest},
+		{http.MethodPost, "/abc/superadmins", `{"username": "` + f.student.UserName + `"}`, http.StatusBadRequest},
+		{http.MethodDelete, "/abc/superadmins/" + f.student.UserName, "", http.StatusBadRequest},
+		{http.MethodPut, fmt.Sprintf("/%d", f.uniId), `{"uni_description": ""}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := asUser(t, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)), admin.UserName)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%s %s: status %d, want %d: %s", tt.method, tt.target, w.Code, tt.code, w.Body.String())
+		}
+	}
+
+	var description sql.NullString
+	if err = db.QueryRow(`SELECT description FROM public."Universities" WHERE uni_id = $1`, f.uniId).Scan(&description); err != nil {
+		t.Fatalf("reading the description: %v", err)
+	}
+	if description.Valid {
+		t.Errorf("description %q, want it cleared", description.String)
+	}
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+var accessibilityFeatures = map[string]bool{
+	"wheelchair":              true,
+	"step_free":               true,
+	"elevator":                true,
+	"accessible_restroom":     true,
+	"gender_neutral_restroom": true,
+	"hearing_loop":            true,
+}
+
+type Venue struct {
+	Location
+	Rooms []Location `json:"rooms"`
+}
+
+// An event holding the room. Events the user may not see only show as busy.
+type BusySlot struct {
+	EventId *int    `json:"event_id,omitempty"`
+	Name    *string `json:"event_name,omitempty"`
+	EventTimes
+}
+
+type FreeSlot struct {
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+}
+
+type RoomCalendar struct {
+	Location
+	Busy []BusySlot `json:"busy"`
+	Free []FreeSlot `json:"free"`
+}
+
+func validateVenue(capacity *int, accessibility []string) error {
+	if capacity != nil && *capacity <= 0 {
+		return errors.New("capacity must be a positive number")
+	}
+	for _, feature := range accessibility {
+		if !accessibilityFeatures[feature] {
+			return errors.New("accessibility can only list wheelchair, step_free, elevator, accessible_restroom, gender_neutral_restroom and hearing_loop")
+		}
+	}
+	return nil
+}
+
+// Reads the features the place must have from ?accessibility=, which may be
+// repeated. Never nil, pq.Array(nil) would send NULL rather than {}.
+func parseAccessibilityFilter(r *http.Request) ([]string, error) {
+	features := append([]string{}, r.URL.Query()["accessibility"]...)
+	if err := validateVenue(nil, features); err != nil {
+		return nil, err
+	}
+	return features, nil
+}
+
+// Places with every feature the parameter lists, or any place, with or
+// without a location, when it lists none or is NULL. For the location
+// aliased as l.
+func accessibleClause(param string) string {
+	return `(COALESCE(cardinality(` + param + `::public.accessibility_feature[]), 0) = 0
+			OR l.accessibility @> ` + param + `::public.accessibility_feature[])`
+}
+
+// The place and, for a building, its rooms. The place itself comes first.
+func getVenueRooms(db querier, locId int) ([]Location, error) {
+	query := `SELECT ` + locationColumns + ` FROM public."Locations" l
+			WHERE l.loc_id = $1 OR l.parent_id = $1
+			ORDER BY l.loc_id <> $1, l.address`
+
+	rows, err := db.Query(query, locId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []Location{}
+	for rows.Next() {
+		var location Location
+		if err = rows.Scan(locationFields(&location)...); err != nil {
+			return nil, err
+		}
+		locations = append(locations, location)
+	}
+
+	return locations, rows.Err()
+}
+
+// A building with its rooms, or a single room
+func GetLocation(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	locId, err := strconv.Atoi(chi.URLParam(r, "locId"))
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Location not found",
+		})
+		return
+	}
+
+	locations, err := getVenueRooms(db, locId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting the Location",
+		})
+		return
+	}
+
+	if len(locations) == 0 {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Location not found",
+		})
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"data":   Venue{Location: locations[0], Rooms: locations[1:]},
+	})
+}
+
+// Gaps between the bookings, given as start and end in turn, sorted by start
+func freeSlots(busy []time.Time, from time.Time, to time.Time) []FreeSlot {
+	free := []FreeSlot{}
+	cursor := from
+	for i := 0; i+1 < len(busy); i += 2 {
+		if busy[i].After(cursor) {
+			free = append(free, FreeSlot{StartTime: cursor.UTC().Format(time.RFC3339), EndTime: busy[i].UTC().Format(time.RFC3339)})
+		}
+		if busy[i+1].After(cursor) {
+			cursor = busy[i+1]
+		}
+	}
+	if to.After(cursor) {
+		free = append(free, FreeSlot{StartTime: cursor.UTC().Format(time.RFC3339), EndTime: to.UTC().Format(time.RFC3339)})
+	}
+	return free
+}
+
+// Auth token required...
+// When the place and each of its rooms are booked between ?from= and ?to=,
+// and the free time left in between. Cancelled events free their slot.
+func GetLocationAvailability(w http.ResponseWriter, r *http.Request) {
+	db, err := connectToDB()
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, err.Error())
+		return
+	}
+	defer db.Close()
+
+	user, err := currentUser(db, r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Could not identify the user",
+		})
+		return
+	}
+
+	from, to, err := parseMapWindow(r)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	locId, err := strconv.Atoi(chi.URLParam(r, "locId"))
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Location not found",
+		})
+		return
+	}
+
+	locations, err := getVenueRooms(db, locId)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting the Location",
+		})
+		return
+	}
+
+	if len(locations) == 0 {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Location not found",
+		})
+		return
+	}
+
+	// Not a scoped transaction: events the user may not see still hold the
+	// room, so they are read here and only their details are left out.
+	// visibleEventClause takes the user as $1
+	query := `SELECT e.loc_id, e.event_id, e.name, e.start_time, e.end_time, e.time_zone, ` + visibleEventClause + `
+			FROM public."Events" e
+			WHERE e.loc_id IN (SELECT loc_id FROM public."Locations" WHERE loc_id = $2 OR parent_id = $2)
+			AND e.status <> 'cancelled' AND e.end_time > $3 AND e.start_time < $4
+			ORDER BY e.loc_id, e.start_time`
+
+	rows, err := db.Query(query, user.UserID, locId, from, to)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error getting the bookings",
+		})
+		return
+	}
+	defer rows.Close()
+
+	busy := map[int][]BusySlot{}
+	bounds := map[int][]time.Time{}
+	for rows.Next() {
+		var roomId, eventId int
+		var name, zone string
+		var start, end time.Time
+		var visible bool
+		err = rows.Scan(&roomId, &eventId, &name, &start, &end, &zone, &visible)
+		if err != nil {
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, map[string]interface{}{
+				"status":  "warning",
+				"message": "Error getting the bookings",
+			})
+			return
+		}
+
+		slot := BusySlot{EventTimes: newEventTimes(start, end, zone)}
+		if visible {
+			slot.EventId, slot.Name = &eventId, &name
+		}
+		busy[roomId] = append(busy[roomId], slot)
+		bounds[roomId] = append(bounds[roomId], start, end)
+	}
+
+	if err = rows.Err(); err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]interface{}{
+			"status":  "warning",
+			"message": "Error iterating over rows",
+		})
+		return
+	}
+
+	calendars := make([]RoomCalendar, 0, len(locations))
+	for _, location := range locations {
+		calendar := RoomCalendar{
+			Location: location,
+			Busy:     busy[location.LocId],
+			Free:     freeSlots(bounds[location.LocId], from, to),
+		}
+		if calendar.Busy == nil {
+			calendar.Busy = []BusySlot{}
+		}
+		calendars = append(calendars, calendar)
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"status": "success",
+		"from":   from.UTC().Format(time.RFC3339),
+		"to":     to.UTC().Format(time.RFC3339),
+		"data":   calendars,
+	})
+}
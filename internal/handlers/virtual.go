@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+var meetingPlatforms = map[string]bool{
+	"zoom":    true,
+	"teams":   true,
+	"meet":    true,
+	"webex":   true,
+	"discord": true,
+	"other":   true,
+}
+
+// Hosts the platforms are recognised by when the organiser names none
+var platformHosts = map[string]string{
+	"zoom.us":             "zoom",
+	"teams.microsoft.com": "teams",
+	"teams.live.com":      "teams",
+	"meet.google.com":     "meet",
+	"webex.com":           "webex",
+	"discord.com":         "discord",
+	"discord.gg":          "discord",
+}
+
+func detectPlatform(host string) string {
+	host = strings.ToLower(host)
+	for domain, platform := range platformHosts {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return platform
+		}
+	}
+	return "other"
+}
+
+// Checks the meeting link of an online or hybrid event and works out its
+// platform when none is given
+func validateMeeting(meetingURL string, platform string) (string, error) {
+	u, err := url.Parse(meetingURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "", errors.New("meeting_url must be an http or https link")
+	}
+
+	if platform == "" {
+		return detectPlatform(u.Hostname()), nil
+	}
+	if !meetingPlatforms[platform] {
+		return "", errors.New("meeting_platform must be zoom, teams, meet, webex, discord or other")
+	}
+	return platform, nil
+}
+
+// Address of the location online events used to be held at
+const legacyOnlineLocation = "Online"
+
+// In person with only a place, online with only a meeting link, hybrid with
+// both
+func attendanceMode(hasLocation bool, hasMeeting bool) (string, error) {
+	switch {
+	case hasLocation && hasMeeting:
+		return "hybrid", nil
+	case hasMeeting:
+		return "online", nil
+	case hasLocation:
+		return "in_person", nil
+	}
+	return "", errors.New("an event needs a location, a meeting_url or both")
+}
@@ -0,0 +1,54 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+)
+
+// DBStore keeps the files in the Media_Blobs table. Open is called for every
+// operation, the way the handlers connect.
+type DBStore struct {
+	Open func() (*sql.DB, error)
+}
+
+func (s DBStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	db, err := s.Open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	query := `INSERT INTO public."Media_Blobs" (key, data, content_type) VALUES ($1, $2, $3)
+			ON CONFLICT (key) DO UPDATE SET data = EXCLUDED.data, content_type = EXCLUDED.content_type`
+	_, err = db.ExecContext(ctx, query, key, data, contentType)
+	return err
+}
+
+func (s DBStore) Get(ctx context.Context, key string) ([]byte, string, error) {
+	db, err := s.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer db.Close()
+
+	var data []byte
+	var contentType string
+	query := `SELECT data, content_type FROM public."Media_Blobs" WHERE key = $1`
+	err = db.QueryRowContext(ctx, query, key).Scan(&data, &contentType)
+	if err == sql.ErrNoRows {
+		return nil, "", ErrNotFound
+	}
+
+	return data, contentType, err
+}
+
+func (s DBStore) Delete(ctx context.Context, key string) error {
+	db, err := s.Open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, `DELETE FROM public."Media_Blobs" WHERE key = $1`, key)
+	return err
+}
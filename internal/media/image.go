@@ -0,0 +1,125 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	// Decoders for the accepted formats
+	_ "image/gif"
+)
+
+const (
+	// Larger images are refused before being decoded
+	MaxPixels = 40_000_000
+	// Thumbnails fit in a square of this size
+	ThumbSize = 256
+)
+
+var ErrUnsupported = errors.New("only PNG, JPEG and GIF images are accepted")
+
+var imageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+type Image struct {
+	ContentType string
+	Width       int
+	Height      int
+	Thumb       []byte
+	ThumbType   string
+}
+
+// Checks the data really is an accepted image, whatever the client claimed,
+// and makes its thumbnail
+func ProcessImage(data []byte) (*Image, error) {
+	contentType := http.DetectContentType(data)
+	if !imageTypes[contentType] {
+		return nil, ErrUnsupported
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("the image could not be read: %w", err)
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, fmt.Errorf("the image is too large, at most %d pixels", MaxPixels)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("the image could not be read: %w", err)
+	}
+
+	thumb := Thumbnail(src, ThumbSize)
+
+	// Photos stay JPEG, anything that may have transparency becomes PNG
+	var buf bytes.Buffer
+	thumbType := "image/png"
+	if contentType == "image/jpeg" {
+		thumbType = "image/jpeg"
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, thumb)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Image{
+		ContentType: contentType,
+		Width:       config.Width,
+		Height:      config.Height,
+		Thumb:       buf.Bytes(),
+		ThumbType:   thumbType,
+	}, nil
+}
+
+// Scales the image down to fit in a size x size square, averaging the source
+// pixels under each target pixel. Smaller images are returned as they are.
+func Thumbnail(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+
+	tw, th := size, size
+	if w > h {
+		th = max(1, h*size/w)
+	} else {
+		tw = max(1, w*size/h)
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0 := bounds.Min.Y + y*h/th
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*h/th)
+		for x := 0; x < tw; x++ {
+			x0 := bounds.Min.X + x*w/tw
+			x1 := max(x0+1, bounds.Min.X+(x+1)*w/tw)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBAModel.Convert(src.At(sx, sy)).(color.NRGBA)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					b += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)})
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,131 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage(w int, h int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func encode(t *testing.T, format string, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatalf("encoding the %s: %v", format, err)
+	}
+	return buf.Bytes()
+}
+
+// A PNG whose header claims a size far larger than its pixels
+func hugePNG(t *testing.T) []byte {
+	data := encode(t, "png", testImage(1, 1))
+	// The IHDR chunk follows the 8 byte signature: length, type, width, height
+	binary.BigEndian.PutUint32(data[16:], 10000)
+	binary.BigEndian.PutUint32(data[20:], 10000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestProcessImage(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		wantType  string
+		thumbType string
+		wantErr   error
+	}{
+		{"png", encode(t, "png", testImage(600, 300)), "image/png", "image/png", nil},
+		{"jpeg", encode(t, "jpeg", testImage(300, 600)), "image/jpeg", "image/jpeg", nil},
+		{"gif", encode(t, "gif", testImage(40, 40)), "image/gif", "image/png", nil},
+		{"text", []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"), "", "", ErrUnsupported},
+		{"bmp", append([]byte("BM"), make([]byte, 64)...), "", "", ErrUnsupported},
+		{"empty", nil, "", "", ErrUnsupported},
+	}
+
+	for _, tt := range tests {
+		got, err := ProcessImage(tt.data)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: error %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got.ContentType != tt.wantType || got.ThumbType != tt.thumbType {
+			t.Errorf("%s: types %s and %s, want %s and %s", tt.name, got.ContentType, got.ThumbType, tt.wantType, tt.thumbType)
+		}
+
+		thumb, _, err := image.DecodeConfig(bytes.NewReader(got.Thumb))
+		if err != nil || thumb.Width > ThumbSize || thumb.Height > ThumbSize {
+			t.Errorf("%s: thumbnail %dx%d, %v", tt.name, thumb.Width, thumb.Height, err)
+		}
+	}
+
+	if _, err := ProcessImage(hugePNG(t)); err == nil {
+		t.Errorf("an image of 100 million pixels was accepted")
+	}
+	// Truncated after the header, so sniffed as PNG but unreadable
+	if _, err := ProcessImage(encode(t, "png", testImage(50, 50))[:40]); err == nil {
+		t.Errorf("a truncated PNG was accepted")
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		w, h         int
+		wantW, wantH int
+	}{
+		{100, 100, 100, 100},
+		{256, 256, 256, 256},
+		{1000, 500, 256, 128},
+		{500, 1000, 128, 256},
+		{3000, 10, 256, 1},
+	}
+
+	for _, tt := range tests {
+		bounds := Thumbnail(testImage(tt.w, tt.h), ThumbSize).Bounds()
+		if bounds.Dx() != tt.wantW || bounds.Dy() != tt.wantH {
+			t.Errorf("%dx%d: got %dx%d, want %dx%d", tt.w, tt.h, bounds.Dx(), bounds.Dy(), tt.wantW, tt.wantH)
+		}
+	}
+
+	// A uniform image keeps its colour when averaged down
+	src := image.NewUniform(color.NRGBA{R: 10, G: 200, B: 30, A: 255})
+	img := image.NewNRGBA(image.Rect(0, 0, 512, 512))
+	for y := 0; y < 512; y++ {
+		for x := 0; x < 512; x++ {
+			img.Set(x, y, src.C)
+		}
+	}
+	if got := Thumbnail(img, ThumbSize).At(5, 5); got != (color.NRGBA{R: 10, G: 200, B: 30, A: 255}) {
+		t.Errorf("averaged colour %v", got)
+	}
+}
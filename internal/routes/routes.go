@@ -34,9 +34,10 @@ func Routes(tokenAuth *jwtauth.JWTAuth) *chi.Mux {
 		r.Mount("/api/users", UserRoutes(tokenAuth))
 		r.Mount("/api/auth", AuthRoutes(tokenAuth))
 		r.Mount("/api/events", EventRoutes(tokenAuth))
-		r.Mount("/api/rsos", RSORoutes())
-		r.Mount("/api/unis", UniRoutes())
-		r.Mount("/api/locations", LocationRoutes())
+		r.Mount("/api/rsos", RSORoutes(tokenAuth))
+		r.Mount("/api/unis", UniRoutes(tokenAuth))
+		r.Mount("/api/locations", LocationRoutes(tokenAuth))
+		r.Mount("/api/media", MediaRoutes())
 		// Add new route groups here
 	})
 
@@ -49,6 +50,7 @@ func UserRoutes(tokenAuth *jwtauth.JWTAuth) http.Handler {
 		r.Use(jwtauth.Verifier(tokenAuth))
 		r.Use(jwtauth.Authenticator)
 		r.Get("/{userId}", handlers.GetUser)
+		r.Put("/phone", handlers.UpdatePhone)
 	})
 
 	// Routes without token need.
@@ -75,11 +77,30 @@ func EventRoutes(tokenAuth *jwtauth.JWTAuth) http.Handler {
 	router.Group(func(r chi.Router) {
 		r.Use(jwtauth.Verifier(tokenAuth))
 		r.Use(jwtauth.Authenticator)
+		r.Get("/", handlers.GetAllEvents)
 		r.Post("/", handlers.CreateEvent)
+		r.Post("/join", handlers.JoinEvent)
+		r.Get("/nearby", handlers.GetNearbyEvents)
+		r.Get("/{eventId}", handlers.GetEvent)
+		r.Post("/{eventId}/contact", handlers.ContactOrganiser)
+		r.Put("/{eventId}/status", handlers.UpdateEventStatus)
+		r.Get("/{eventId}/status", handlers.GetEventStatusHistory)
+		r.Put("/{eventId}/attendance/{username}", handlers.AttendEvent)
+
+		// Co-hosting between RSOs
+		r.Get("/hosts/invitations", handlers.GetCoHostInvitations)
+		r.Post("/{eventId}/hosts", handlers.InviteCoHost)
+		r.Put("/{eventId}/hosts/{rsoId}", handlers.RespondCoHost)
+
+		// Invitations for invite-only events
+		r.Get("/invitations", handlers.GetUserInvitations)
+		r.Post("/invitations/redeem", handlers.RedeemInvitationLink)
+		r.Get("/{eventId}/invitations", handlers.GetEventInvitations)
+		r.Post("/{eventId}/invitations", handlers.InviteToEvent)
+		r.Put("/{eventId}/invitations", handlers.RespondInvitation)
+		r.Post("/{eventId}/invitations/link", handlers.CreateInvitationLink)
 	})
 
-	router.Get("/", handlers.GetAllEvents)
-
 	router.Get("/user", handlers.GetUserEvents)
 	router.Delete("/{eventId}", handlers.DeleteEvent)
 	router.Put("/{eventId}", handlers.UpdateEvent)
@@ -88,42 +109,111 @@ func EventRoutes(tokenAuth *jwtauth.JWTAuth) http.Handler {
 	// router.Post("/", handlers.CreateEvent) commented in favor of auth version
 
 	// Add new event-related endpoints here (e.g., attend/unattend event, submit feedback)
-	router.Post("/join", handlers.JoinEvent)
 	router.Delete("/attend", handlers.UnattendEvent)  // Example for unattending an event
 	router.Post("/feedback", handlers.CreateFeedback) // Example for submitting feedback
 	router.Get("/feedback", handlers.GetFeedback)
 	return router
 }
 
-func RSORoutes() http.Handler {
+func RSORoutes(tokenAuth *jwtauth.JWTAuth) http.Handler {
 	router := chi.NewRouter()
-	router.Get("/", handlers.GetAllRSOs)
+	router.Group(func(r chi.Router) {
+		r.Use(jwtauth.Verifier(tokenAuth))
+		r.Use(jwtauth.Authenticator)
+
+		// RSOs are created through applications approved by a superadmin
+		r.Post("/applications", handlers.SubmitRSOApplication)
+		r.Get("/applications", handlers.GetUserRSOApplications)
+		r.Put("/applications/{appId}/confirm", handlers.ConfirmRSOApplication)
+		r.Get("/applications/review", handlers.GetRSOApplicationQueue)
+		r.Put("/applications/{appId}/review", handlers.ReviewRSOApplication)
+
+		r.Get("/{rsoId}", handlers.GetRSO)
+		r.Delete("/{rsoId}", handlers.DeleteRSO)
+		r.Put("/{rsoId}", handlers.UpdateRSO)
+		r.Get("/{rsoId}/analytics", handlers.GetRSOAnalytics)
+		r.Put("/{rsoId}/logo", handlers.UploadRSOLogo)
+		r.Delete("/{rsoId}/logo", handlers.DeleteRSOLogo)
+		r.Get("/{rsoId}/members", handlers.GetRSOMembers)
+		r.Get("/{rsoId}/members/export", handlers.ExportRSOMembers)
+		r.Delete("/{rsoId}/members/{username}", handlers.RemoveRSOMember)
+		r.Put("/{rsoId}/members/{username}/role", handlers.SetMemberRole)
+		r.Post("/{rsoId}/transfer", handlers.RequestAdminTransfer)
+		r.Put("/{rsoId}/transfer", handlers.RespondAdminTransfer)
+		r.Delete("/{rsoId}/transfer", handlers.CancelAdminTransfer)
+
+		r.Get("/", handlers.GetAllRSOs)
+		r.Get("/recommended", handlers.GetRecommendedRSOs)
+		r.Post("/join", handlers.JoinRSO)
+		r.Put("/leave", handlers.LeaveRSO)
+		r.Delete("/{rsoId}/join", handlers.LeaveRSO)
+		r.Get("/join/requests", handlers.GetUserJoinRequests)
+		r.Put("/join/invites/{requestId}", handlers.RespondRSOInvite)
+		r.Get("/{rsoId}/requests", handlers.GetRSOJoinRequests)
+		r.Put("/{rsoId}/requests/{requestId}", handlers.ReviewJoinRequest)
+		r.Post("/{rsoId}/invites", handlers.InviteToRSO)
+
+		r.Get("/announcements", handlers.GetAnnouncementFeed)
+		r.Put("/announcements/{announcementId}/read", handlers.MarkAnnouncementRead)
+		r.Delete("/announcements/{announcementId}/read", handlers.MarkAnnouncementRead)
+		r.Get("/{rsoId}/announcements", handlers.GetRSOAnnouncements)
+		r.Post("/{rsoId}/announcements", handlers.CreateAnnouncement)
+		r.Put("/{rsoId}/announcements/{announcementId}", handlers.UpdateAnnouncement)
+		r.Delete("/{rsoId}/announcements/{announcementId}", handlers.DeleteAnnouncement)
+	})
+
 	router.Get("/user", handlers.GetUserRSOs)
-	router.Put("/leave", handlers.LeaveRSO)
-	router.Post("/", handlers.CreateRSO)
-	router.Get("/{rsoId}", handlers.GetRSO)
-	router.Delete("/{rsoId}", handlers.DeleteRSO)
-	router.Put("/{rsoId}", handlers.UpdateRSO)
 
 	// Add new RSO-related endpoints here (e.g., join/leave RSO)
-	router.Post("/join", handlers.JoinRSO)            // Example for joining an RSO
-	router.Delete("/{rsoId}/join", handlers.LeaveRSO) // Example for leaving an RSO
 	return router
 }
 
-func UniRoutes() http.Handler {
+func UniRoutes(tokenAuth *jwtauth.JWTAuth) http.Handler {
 	router := chi.NewRouter()
+	router.Group(func(r chi.Router) {
+		r.Use(jwtauth.Verifier(tokenAuth))
+		r.Use(jwtauth.Authenticator)
+		r.Put("/{uni_id}/rso_threshold", handlers.UpdateRSOThreshold)
+		r.Post("/", handlers.CreateUniversity)
+		r.Put("/{uni_id}", handlers.UpdateUniDetails)
+		r.Delete("/{uni_id}", handlers.ArchiveUniversity)
+		r.Put("/{uni_id}/picture", handlers.UploadUniPicture)
+		r.Get("/{uni_id}/superadmins", handlers.GetUniSuperadmins)
+		r.Post("/{uni_id}/superadmins", handlers.AssignSuperadmin)
+		r.Delete("/{uni_id}/superadmins/{username}", handlers.UnassignSuperadmin)
+		r.Get("/{uni_id}/map", handlers.GetUniMap)
+		r.Post("/{uni_id}/gazetteer", handlers.ImportGazetteer) // text/csv or application/geo+json, ?replace=true
+	})
+
 	router.Get("/", handlers.GetAllUnis)
-	router.Put("/{uni_id}", handlers.UpdateUniDetails)
+	router.Get("/{uni_id}/geocode", handlers.GeocodeAddress)         // ?q=
+	router.Get("/{uni_id}/geocode/reverse", handlers.ReverseGeocode) // ?lat=&lng=
 	// Add new Uni-related endpoints here (e.g. join/leave Uni)
 
 	return router
 }
 
-func LocationRoutes() http.Handler {
+func LocationRoutes(tokenAuth *jwtauth.JWTAuth) http.Handler {
 	router := chi.NewRouter()
-	router.Get("/", handlers.GetAllLocations) // Assuming all visible events in a given radius is shown
-	router.Post("/create", handlers.CreateLocation)
+	router.Group(func(r chi.Router) {
+		r.Use(jwtauth.Verifier(tokenAuth))
+		r.Use(jwtauth.Authenticator)
+		r.Get("/{locId}/availability", handlers.GetLocationAvailability) // ?from=&to=
+		r.Post("/{locId}/merge", handlers.MergeLocation)
+	})
+
+	router.Get("/", handlers.GetAllLocations) // ?lat=&lng=&radius= for the locations around a point, ?accessibility= to filter
+	router.Get("/{locId}", handlers.GetLocation)
+	router.Get("/{locId}/duplicates", handlers.GetLocationDuplicates)
+	router.Post("/create", handlers.CreateLocation) // ?force=true to skip the duplicate check
 	// Add other routes as required (e.g. add/delete locations)
 	return router
 }
+
+// Uploaded files, served without a token so they can be used in <img> tags
+func MediaRoutes() http.Handler {
+	router := chi.NewRouter()
+	router.Get("/{mediaId}", handlers.GetMedia)
+	router.Get("/{mediaId}/{variant:thumb}", handlers.GetMedia)
+	return router
+}
@@ -1,15 +1,23 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/go-chi/jwtauth"
 	"github.com/joho/godotenv"
 
+	"github.com/bingKegeta/Knight-Link/internal/handlers"
+	"github.com/bingKegeta/Knight-Link/internal/media"
+	"github.com/bingKegeta/Knight-Link/internal/notify"
 	"github.com/bingKegeta/Knight-Link/internal/routes"
 )
 
@@ -29,6 +37,21 @@ func init() {
 	}
 
 	tokenAuth = jwtauth.New("HS256", []byte(os.Getenv("SECRET_KEY")), nil)
+
+	// Uploads go to Postgres unless another store is configured
+	switch os.Getenv("MEDIA_STORE") {
+	case "fs":
+		handlers.SetMediaStore(media.FSStore{Dir: os.Getenv("MEDIA_DIR")})
+	case "s3":
+		handlers.SetMediaStore(media.NewS3Store(os.Getenv("S3_ENDPOINT"), os.Getenv("S3_REGION"),
+			os.Getenv("S3_BUCKET"), os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY")))
+	}
+
+	// Without SMTP settings notifications only go to the log
+	if os.Getenv("SMTP_HOST") != "" {
+		handlers.SetNotifier(notify.NewSMTPNotifier(os.Getenv("SMTP_HOST"), os.Getenv("SMTP_PORT"),
+			os.Getenv("SMTP_USER"), os.Getenv("SMTP_PW"), os.Getenv("SMTP_FROM")))
+	}
 }
 
 func New() *App {
@@ -46,6 +69,8 @@ func (a *App) Start(ctx context.Context) error {
 		Handler: a.router,
 	}
 
+	go handlers.CompleteFinishedEvents(ctx, time.Minute)
+
 	err := server.ListenAndServe()
 	if err != nil {
 		return fmt.Errorf("failed to start server: %w", err)
@@ -54,7 +79,39 @@ func (a *App) Start(ctx context.Context) error {
 	return nil
 }
 
+// superadmin -username ... -uni ... creates the platform superadmin instead
+// of starting the server. The password of a new user is taken from
+// KNIGHTLINK_BOOTSTRAP_PASSWORD or else read from stdin, never from the
+// arguments, which other users of the machine can see.
+func bootstrap(args []string) error {
+	flags := flag.NewFlagSet("superadmin", flag.ExitOnError)
+	username := flags.String("username", "", "username of the superadmin")
+	email := flags.String("email", "", "email address, for a new user")
+	uni := flags.String("uni", "", "university of the superadmin, created if missing")
+	flags.Parse(args)
+
+	password, ok := os.LookupEnv("KNIGHTLINK_BOOTSTRAP_PASSWORD")
+	if !ok {
+		fmt.Fprint(os.Stderr, "Password (for a new user): ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	return handlers.BootstrapSuperadmin(*username, *email, password, *uni)
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "superadmin" {
+		if err := bootstrap(os.Args[2:]); err != nil {
+			log.Fatal("failed to create the superadmin: ", err)
+		}
+		fmt.Println("Superadmin ready.")
+		return
+	}
+
 	app := New()
 
 	err := app.Start(context.TODO())